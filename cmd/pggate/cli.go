@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/router"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "[--config file]", "run the proxy (the default)", serve},
+		{"check-config", "[--config file]", "validate a configuration file", checkConfig},
+		{"version", "", "print the version", printVersion},
+		{"route", "[flags] <sql>", "show where a query would be routed and why", route},
+		{"admin", "[--addr url] <command> [args]", "control a running instance through its admin API", adminCommand},
+	}
+}
+
+// run dispatches a command line and returns the exit code. Without a
+// command, or with only flags, it serves.
+func run(args []string, stdout, stderr io.Writer) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(stdout)
+		return 0
+	}
+	for _, c := range commands() {
+		if c.name == name {
+			return c.run(args, stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "pggate: unknown command %q\n\n", name)
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: pggate <command> [args]")
+	fmt.Fprintln(w)
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-13s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun pggate <command> --help for the flags of a command.")
+}
+
+// newFlagSet creates the flags of a command, printing errors to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	for _, c := range commands() {
+		if c.name == name {
+			fs.Usage = func() {
+				fmt.Fprintf(stderr, "Usage: pggate %s %s\n", c.name, c.args)
+				fs.PrintDefaults()
+			}
+		}
+	}
+	return fs
+}
+
+// parseFlags parses args and returns the exit code when the command should
+// not run.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	switch err := fs.Parse(args); {
+	case errors.Is(err, flag.ErrHelp):
+		return 0, false
+	case err != nil:
+		return 2, false
+	}
+	return 0, true
+}
+
+// defaultConfigPath is the configuration file used without --config.
+func defaultConfigPath() string {
+	return cmp.Or(os.Getenv("PGGATE_CONFIG"), "config.yaml")
+}
+
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", defaultConfigPath(), "configuration `file`, also set by PGGATE_CONFIG")
+}
+
+// checkConfig validates a configuration file without starting the proxy.
+func checkConfig(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("check-config", stderr)
+	path := configFlag(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if _, err := config.Load(*path); err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: configuration is valid\n", *path)
+	return 0
+}
+
+func printVersion(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("version", stderr)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	fmt.Fprintf(stdout, "pggate %s", version)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				fmt.Fprintf(stdout, " (%.12s)", s.Value)
+			}
+		}
+	}
+	fmt.Fprintf(stdout, " %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return 0
+}
+
+// route prints the routing decision for a query, using the routing rules
+// and replica groups of the configuration file.
+func route(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("route", stderr)
+	path := configFlag(fs)
+	var sc router.SessionContext
+	fs.StringVar(&sc.User, "user", "", "client user")
+	fs.StringVar(&sc.Database, "database", "", "client database, defaults to the user")
+	fs.StringVar(&sc.ApplicationName, "application-name", "", "client application_name")
+	fs.BoolVar(&sc.InTransaction, "in-transaction", false, "route as if inside a transaction block")
+	fs.BoolVar(&sc.Pinned, "pinned", false, "route as if session variables pinned the session to the primary")
+	extended := fs.Bool("extended", false, "route as a Parse message of the extended protocol")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	cfg, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	r, err := newRouter(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid routing rules: %v\n", err)
+		return 1
+	}
+	sc.Database = cmp.Or(sc.Database, sc.User)
+
+	stmt := router.ParseStatement(fs.Arg(0))
+	stmt.Extended = *extended
+	d, _ := r.Decide(stmt, sc)
+	fmt.Fprintf(stdout, "statement:   %s\n", stmt.Type)
+	fmt.Fprintf(stdout, "destination: %s\n", d.Destination)
+	if d.Destination == router.Replica {
+		fmt.Fprintf(stdout, "group:       %s\n", cmp.Or(d.Group, "default"))
+	}
+	fmt.Fprintf(stdout, "reason:      %s\n", describeReason(cfg, d))
+	if d.Destination == router.Replica {
+		if replicas := groupReplicas(cfg, d.Group); len(replicas) > 0 {
+			fmt.Fprintf(stdout, "replicas:    %s\n", strings.Join(replicas, ", "))
+		} else {
+			fmt.Fprintf(stdout, "replicas:    none configured, the query runs on the primary %s\n", cfg.Backend.Primary.Address)
+		}
+	} else {
+		fmt.Fprintf(stdout, "backend:     %s\n", cfg.Backend.Primary.Address)
+	}
+	return 0
+}
+
+// describeReason spells out the routing rule behind a decision.
+func describeReason(cfg *config.Config, d router.Decision) string {
+	var i int
+	if _, err := fmt.Sscanf(d.Reason, "rule %d", &i); err != nil || i < 0 || i >= len(cfg.Routing.Rules) {
+		return d.Reason
+	}
+	rule := cfg.Routing.Rules[i]
+	var match []string
+	for _, f := range [][2]string{
+		{"user", rule.User},
+		{"database", rule.Database},
+		{"application_name", rule.ApplicationName},
+		{"query", rule.Query},
+	} {
+		if f[1] != "" {
+			match = append(match, fmt.Sprintf("%s=%q", f[0], f[1]))
+		}
+	}
+	return fmt.Sprintf("%s (routing.rules[%d] %s)", d.Reason, i, strings.Join(match, " "))
+}
+
+func groupReplicas(cfg *config.Config, group string) []string {
+	nodes := cfg.Backend.Replicas
+	if group != pool.DefaultGroup {
+		nodes = nil
+		for _, g := range cfg.Backend.Groups {
+			if g.Name == group {
+				nodes = g.Replicas
+			}
+		}
+	}
+	var out []string
+	for _, n := range nodes {
+		out = append(out, n.Address)
+	}
+	return out
+}
+
+// adminRequests maps admin subcommands to admin API requests; the path
+// may take the subcommand's argument.
+var adminRequests = map[string]struct {
+	method, path string
+	arg          string // name of the required argument, if any
+	summary      string
+}{
+	"pools":    {http.MethodGet, "/admin/pools", "", "pool statistics per backend"},
+	"backends": {http.MethodGet, "/admin/backends", "", "backend health and pool statistics"},
+	"sessions": {http.MethodGet, "/admin/sessions", "", "connected client sessions"},
+	"clients":  {http.MethodGet, "/admin/clients", "", "statistics per user, database and application"},
+	"queries":  {http.MethodGet, "/admin/queries", "", "statistics per normalized query"},
+	"kill":     {http.MethodDelete, "/admin/sessions/%s", "id", "disconnect a client session"},
+	"drain":    {http.MethodPost, "/admin/backends/%s/drain", "address", "drain and remove a replica"},
+	"reload":   {http.MethodPost, "/admin/reload", "", "re-read the configuration file"},
+	"pause":    {http.MethodPost, "/admin/pause", "", "hold new queries for backend maintenance"},
+	"resume":   {http.MethodPost, "/admin/resume", "", "release held queries"},
+	"health":   {http.MethodGet, "/readyz", "", "readiness of the proxy"},
+}
+
+// adminCommand sends a request to the admin API of a running instance and
+// prints the JSON response.
+func adminCommand(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("admin", stderr)
+	path := configFlag(fs)
+	addr := fs.String("addr", "", "admin API `url`, defaults to metrics.address of the configuration")
+	token := fs.String("token", "", "admin API bearer `token`, defaults to admin.http_token of the configuration")
+	timeout := fs.Duration("timeout", 0, "how long drain and pause may wait, 0 for the server default")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: pggate admin [flags] <command> [args]")
+		fmt.Fprintln(stderr, "\nCommands:")
+		for _, name := range slices.Sorted(maps.Keys(adminRequests)) {
+			req := adminRequests[name]
+			fmt.Fprintf(stderr, "  %-20s %s\n", strings.TrimSpace(name+" "+angle(req.arg)), req.summary)
+		}
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	req, ok := adminRequests[fs.Arg(0)]
+	nargs := 1
+	if req.arg != "" {
+		nargs = 2
+	}
+	if !ok || fs.NArg() != nargs {
+		fs.Usage()
+		return 2
+	}
+	base, bearer := *addr, *token
+	if base == "" || bearer == "" {
+		cfg, err := adminConfig(*path)
+		if err != nil {
+			fmt.Fprintln(stderr, "pggate:", err)
+			return 1
+		}
+		if base == "" {
+			if base, err = adminURL(cfg.Metrics.Address); err != nil {
+				fmt.Fprintln(stderr, "pggate:", err)
+				return 1
+			}
+		}
+		if bearer == "" {
+			bearer = cfg.Admin.HTTPToken
+		}
+	}
+	target := strings.TrimSuffix(base, "/") + req.path
+	if req.arg != "" {
+		target = fmt.Sprintf(target, url.PathEscape(fs.Arg(1)))
+	}
+	if *timeout > 0 {
+		target += "?timeout=" + timeout.String()
+	}
+
+	httpReq, err := http.NewRequest(req.method, target, nil)
+	if err != nil {
+		fmt.Fprintln(stderr, "pggate:", err)
+		return 1
+	}
+	if bearer != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	// no client timeout: the server bounds drain and pause
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		fmt.Fprintln(stderr, "pggate:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintln(stderr, "pggate:", err)
+		return 1
+	}
+	var out bytes.Buffer
+	if json.Indent(&out, body, "", "  ") != nil {
+		out.Reset()
+		out.Write(body)
+	}
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(stderr, "pggate: %s\n%s\n", resp.Status, bytes.TrimSpace(out.Bytes()))
+		return 1
+	}
+	fmt.Fprintln(stdout, strings.TrimSpace(out.String()))
+	return 0
+}
+
+// adminConfig loads the settings the admin command needs from the
+// configuration file. Without a file it uses the defaults and the
+// environment overrides.
+func adminConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return cfg, err
+	}
+	cfg = &config.Config{}
+	cfg.Metrics.Address = config.DefaultMetricsAddress
+	cfg.Admin.HTTPToken = os.Getenv(config.EnvPrefix + "ADMIN_HTTP_TOKEN")
+	return cfg, nil
+}
+
+// adminURL turns metrics.address into the admin API URL.
+func adminURL(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+func angle(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "<" + s + ">"
+}
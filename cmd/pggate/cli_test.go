@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun_CheckConfig(t *testing.T) {
+	valid := writeConfig(t, "backend:\n  primary:\n    address: \"db:5432\"\n")
+	invalid := writeConfig(t, "listener:\n  max_connections: -1\n")
+	tests := []struct {
+		args     []string
+		wantCode int
+		want     string
+	}{
+		{[]string{"check-config", "--config", valid}, 0, "configuration is valid"},
+		{[]string{"check-config", "--config", invalid}, 1, "listener.max_connections: must be positive"},
+		{[]string{"check-config", "--config", valid, "--verbose"}, 2, "flag provided but not defined"},
+		{[]string{"bogus"}, 2, `unknown command "bogus"`},
+		{[]string{"version"}, 0, "pggate dev"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, &stdout, &stderr)
+		if code != tt.wantCode || !strings.Contains(stdout.String()+stderr.String(), tt.want) {
+			t.Errorf("run(%q) = %d, output %q, want %d and %q", tt.args, code, stdout.String()+stderr.String(), tt.wantCode, tt.want)
+		}
+	}
+}
+
+func TestRun_Route(t *testing.T) {
+	path := writeConfig(t, `
+backend:
+  primary:
+    address: "primary:5432"
+  replicas:
+    - address: "replica1:5432"
+  groups:
+    - name: analytics
+      replicas:
+        - address: "analytics1:5432"
+routing:
+  rules:
+    - group: analytics
+      application_name: metabase
+`)
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"SELECT 1"}, []string{"destination: replica", "group:       default", "read-only statement", "replica1:5432"}},
+		{[]string{"--application-name", "metabase", "SELECT 1"}, []string{"group:       analytics", `rule 0 (routing.rules[0] application_name="metabase")`, "analytics1:5432"}},
+		{[]string{"UPDATE t SET a = 1"}, []string{"statement:   update", "destination: primary", "backend:     primary:5432"}},
+		{[]string{"--in-transaction", "SELECT 1"}, []string{"destination: primary", "reason:      in transaction"}},
+		{[]string{"/* pggate:group=reporting */ SELECT 1"}, []string{"group:       reporting", "query hint", "none configured"}},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"route", "--config", path}, tt.args...)
+		if code := run(args, &stdout, &stderr); code != 0 {
+			t.Fatalf("run(%q) = %d, stderr %q", args, code, stderr.String())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("run(%q) output:\n%s\nwant %q", args, stdout.String(), want)
+			}
+		}
+	}
+}
+
+func TestRun_Admin(t *testing.T) {
+	var got []string
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Method+" "+r.URL.RequestURI())
+		auth = r.Header.Get("Authorization")
+		if r.URL.Path == "/admin/sessions/7" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"no such session"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		args     []string
+		wantCode int
+		wantReq  string
+		want     string
+	}{
+		{[]string{"pools"}, 0, "GET /admin/pools", `"status": "ok"`},
+		{[]string{"--timeout", "10s", "drain", "replica1:5432"}, 0, "POST /admin/backends/replica1:5432/drain?timeout=10s", "ok"},
+		{[]string{"kill", "7"}, 1, "DELETE /admin/sessions/7", "no such session"},
+		{[]string{"health"}, 0, "GET /readyz", "ok"},
+	}
+	for _, tt := range tests {
+		got = nil
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"admin", "--addr", srv.URL}, tt.args...)
+		code := run(args, &stdout, &stderr)
+		if code != tt.wantCode || len(got) != 1 || got[0] != tt.wantReq {
+			t.Errorf("run(%q) = %d, requests %q, want %d and %q", args, code, got, tt.wantCode, tt.wantReq)
+		}
+		if out := stdout.String() + stderr.String(); !strings.Contains(out, tt.want) {
+			t.Errorf("run(%q) output %q, want %q", args, out, tt.want)
+		}
+	}
+
+	file := writeConfig(t, "backend:\n  primary:\n    address: \"db:5432\"\nadmin:\n  http_token: from-file\n")
+	tokens := []struct {
+		args []string
+		env  string
+		want string
+	}{
+		{[]string{"--token", "secret"}, "", "Bearer secret"},
+		{[]string{"--config", file}, "", "Bearer from-file"},
+		{[]string{"--config", "missing.yaml"}, "from-env", "Bearer from-env"},
+		{[]string{"--config", file, "--token", "secret"}, "from-env", "Bearer secret"},
+	}
+	for _, tt := range tokens {
+		if tt.env != "" {
+			t.Setenv("PGGATE_ADMIN_HTTP_TOKEN", tt.env)
+		}
+		auth = ""
+		args := append(append([]string{"admin", "--addr", srv.URL}, tt.args...), "reload")
+		if code := run(args, &bytes.Buffer{}, &bytes.Buffer{}); code != 0 || auth != tt.want {
+			t.Errorf("run(%q) = %d, Authorization %q, want 0 and %q", args, code, auth, tt.want)
+		}
+	}
+
+	got = nil
+	if code := run([]string{"admin", "--addr", srv.URL, "kill"}, &bytes.Buffer{}, &bytes.Buffer{}); code != 2 || len(got) != 0 {
+		t.Errorf("run(admin kill) without an id = %d, want 2 and no request", code)
+	}
+}
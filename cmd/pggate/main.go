@@ -1,57 +1,106 @@
 package main
 
 import (
-	"log"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/user/pggate/internal/admin"
 	"github.com/user/pggate/internal/config"
 	"github.com/user/pggate/internal/listener"
+	"github.com/user/pggate/internal/logging"
 	"github.com/user/pggate/internal/metrics"
 	"github.com/user/pggate/internal/pool"
 	"github.com/user/pggate/internal/proxy"
-	"github.com/user/pggate/internal/router"
+	"github.com/user/pggate/internal/slowlog"
+	"github.com/user/pggate/internal/tracing"
 )
 
 func main() {
-	cfg, err := config.Load("config.yaml")
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// serve runs the proxy until SIGINT or SIGTERM.
+func serve(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("serve", stderr)
+	configPath := configFlag(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
-		panic(err)
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	if err := logging.Setup(logging.Config{Level: cfg.Logging.Level, Format: cfg.Logging.Format}); err != nil {
+		fatal("invalid logging config", "err", err)
 	}
 	primary := cfg.Backend.Primary.Address
 	replicas := make([]string, len(cfg.Backend.Replicas))
 	for i, r := range cfg.Backend.Replicas {
 		replicas[i] = r.Address
 	}
-	pm := pool.NewPoolManager(
-		primary,
-		replicas,
-		cfg.Pool.PrimarySize,
-		cfg.Pool.ReplicaSize,
-		60,
-	)
-	r := router.NewRouter()
-	p := proxy.NewProxy(pm, r)
-	l := listener.NewServer(listener.ListenerConfig{
-		Address:        cfg.Listener.Address,
-		MaxConnections: cfg.Listener.MaxConnections,
-		ReadTimeout:    cfg.Listener.ReadTimeout,
-		WriteTimeout:   cfg.Listener.WriteTimeout,
-	}, p)
+	rwCfg, roCfg := poolConfigs(cfg)
+	pm := pool.NewPoolManagerWithConfig(primary, poolNodes(cfg.Backend.Replicas), rwCfg, roCfg)
+	balancers, err := groupBalancers(cfg)
+	if err != nil {
+		fatal("invalid config", "err", err)
+	}
+	applyGroups(pm, cfg, balancers)
+	pm.SetOutlierDetection(outlierConfig(cfg))
+	pm.SetDrainTimeout(cmp.Or(cfg.Pool.DrainTimeout, pool.DefaultDrainTimeout))
+	r, err := newRouter(cfg)
+	if err != nil {
+		fatal("invalid routing rules", "err", err)
+	}
+	slowLog, err := slowlog.New(slowlog.Config{
+		Threshold: cfg.SlowQueryLog.Threshold,
+		Path:      cfg.SlowQueryLog.Path,
+		Redact:    cfg.SlowQueryLog.Redact,
+	})
+	if err != nil {
+		fatal("failed to open slow query log", "err", err)
+	}
+	tracer := tracing.New(tracing.Config{
+		Endpoint:    cfg.Tracing.Endpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: *cfg.Tracing.SampleRatio,
+	})
+	rl := &reloader{path: *configPath, started: cfg, pm: pm}
+	rl.current.Store(cfg)
+	proxyCfg := rl.proxyConfig(cfg)
+	proxyCfg.SlowLog = slowLog
+	proxyCfg.Tracer = tracer
+	p := proxy.NewProxy(proxyCfg, pm, r)
+	l := listener.NewServer(listenerConfig(cfg), p)
+	rl.proxy, rl.listener = p, l
 
-	// Start metrics server
+	metrics.Register(pm)
+	metrics.Register(p.ClientStats())
+	ms := metrics.NewServer(cfg.Metrics.Address, metrics.Default)
+	ah := admin.NewHandler(pm, p, l)
+	ms.Handle("/admin/", ah)
+	ms.Handle("/healthz", ah)
+	ms.Handle("/readyz", ah)
 	go func() {
-		metricsAddr := ":8080"
-		log.Printf("Metrics server listening on %s", metricsAddr)
-		if err := metrics.ServeMetrics(metricsAddr); err != nil {
-			log.Printf("metrics server error: %v", err)
+		slog.Info("metrics server listening", "address", ms.Addr())
+		if err := ms.ListenAndServe(); err != nil {
+			slog.Error("metrics server error", "err", err)
 		}
 	}()
 
-	log.Printf("PgGate listening on %s", cfg.Listener.Address)
-	log.Printf("Primary: %s, Replicas: %v", primary, replicas)
+	go func() {
+		if err := l.Start(); err != nil {
+			fatal("listener failed", "err", err)
+		}
+	}()
+	slog.Info("PgGate listening", "address", cfg.Listener.Address, "primary", primary, "replicas", replicas)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
@@ -59,24 +108,44 @@ func main() {
 	for {
 		sig := <-sigChan
 		if sig == syscall.SIGHUP {
-			log.Println("Reloading configuration...")
-			newCfg, err := config.Load("config.yaml")
-			if err != nil {
-				log.Printf("failed to reload config: %v", err)
-				continue
+			if _, err := rl.reload(); err != nil {
+				slog.Error("failed to reload config", "err", err)
 			}
-			// Update components (simplified: only some fields for now)
-			// TODO: Add more dynamic update logic
-			_ = newCfg
-			log.Println("Configuration reloaded (partial)")
 			continue
 		}
 
-		log.Printf("Received signal %v, shutting down...", sig)
+		slog.Info("shutting down", "signal", sig.String())
 		break
 	}
 
-	l.Stop()
+	// a second SIGINT or SIGTERM skips the graceful phase
+	go func() {
+		for sig := range sigChan {
+			if sig != syscall.SIGHUP {
+				slog.Warn("forced shutdown", "signal", sig.String())
+				os.Exit(1)
+			}
+		}
+	}()
+	timeout := rl.current.Load().Listener.ShutdownTimeout
+	slog.Info("waiting for open transactions", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	if err := l.Shutdown(ctx); err != nil {
+		slog.Warn("closed client sessions before their transactions ended", "err", err)
+	}
+	cancel()
 	pm.Close()
-	log.Println("PgGate shutdown complete")
+	slowLog.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	if err := tracer.Shutdown(ctx); err != nil {
+		slog.Warn("flushing traces failed", "err", err)
+	}
+	cancel()
+	slog.Info("PgGate shutdown complete")
+	return 0
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/listener"
+	"github.com/user/pggate/internal/logging"
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/proxy"
+	"github.com/user/pggate/internal/router"
+)
+
+// reloader applies the configuration file to the running components.
+type reloader struct {
+	path     string
+	started  *config.Config // settings that need a restart keep these values
+	current  atomic.Pointer[config.Config]
+	pm       *pool.PoolManager
+	proxy    *proxy.Proxy
+	listener *listener.Server
+
+	mu sync.Mutex // one reload at a time
+}
+
+// reload loads the configuration file and applies what changed without
+// closing client sessions. It returns the changed settings that only take
+// effect after a restart. An invalid file changes nothing.
+func (rl *reloader) reload() ([]string, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	slog.Info("reloading configuration", "path", rl.path)
+	next, err := config.Load(rl.path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRouter(next)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing rules: %w", err)
+	}
+	balancers, err := groupBalancers(next)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := logging.ParseLevel(next.Logging.Level); err != nil {
+		return nil, err
+	}
+	restart, err := config.RestartRequired(rl.started, next)
+	if err != nil {
+		return nil, err
+	}
+
+	rwCfg, roCfg := poolConfigs(next)
+	rl.pm.SetConfig(rwCfg, roCfg)
+	rl.pm.SetOutlierDetection(outlierConfig(next))
+	rl.pm.SetDrainTimeout(cmp.Or(next.Pool.DrainTimeout, pool.DefaultDrainTimeout))
+	applyGroups(rl.pm, next, balancers)
+	rl.proxy.SetRouter(r)
+	rl.proxy.SetConfig(rl.proxyConfig(next))
+	rl.listener.SetConfig(listenerConfig(next))
+	_ = logging.SetLevel(next.Logging.Level)
+	rl.current.Store(next)
+
+	if len(restart) > 0 {
+		slog.Warn("configuration reloaded, some changes need a restart", "restart_required", restart)
+	} else {
+		slog.Info("configuration reloaded")
+	}
+	return restart, nil
+}
+
+func (rl *reloader) settings() ([]config.Setting, error) {
+	return rl.current.Load().Settings()
+}
+
+// proxyConfig builds the proxy settings of cfg, with the admin console
+// wired to the reloader.
+func (rl *reloader) proxyConfig(cfg *config.Config) proxy.ProxyConfig {
+	return proxy.ProxyConfig{
+		HashKey: cfg.Pool.HashKey,
+		Sticky:  cfg.Pool.Sticky,
+
+		MaxClientStats: cfg.Stats.MaxClients,
+		MaxQueryStats:  cfg.Stats.MaxQueries,
+		LogQueries:     cfg.Logging.Queries,
+		Admin: proxy.AdminConfig{
+			Database: cfg.Admin.Database,
+			Users:    cfg.Admin.Users,
+			Password: cfg.Admin.Password,
+
+			HTTPToken:    cfg.Admin.HTTPToken,
+			PauseTimeout: cfg.Admin.PauseTimeout,
+			DrainTimeout: cfg.Pool.DrainTimeout,
+			Reload:       rl.reload,
+			Settings:     rl.settings,
+		},
+	}
+}
+
+func poolConfigs(cfg *config.Config) (rw, ro pool.Config) {
+	base := pool.Config{
+		MinIdle:        cfg.Pool.MinIdle,
+		MaxIdle:        cfg.Pool.MaxIdle,
+		IdleTimeout:    cfg.Pool.IdleTimeout,
+		MaxLifetime:    cfg.Pool.MaxLifetime,
+		AcquireTimeout: cfg.Pool.AcquireTimeout,
+
+		PingIdleThreshold: cfg.Pool.PingIdleThreshold,
+		KeepAlive: net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     cfg.Pool.KeepAlive.Idle,
+			Interval: cfg.Pool.KeepAlive.Interval,
+			Count:    cfg.Pool.KeepAlive.Count,
+		},
+	}
+	rw, ro = base, base
+	rw.MaxSize = cfg.Pool.PrimarySize
+	ro.MaxSize = cfg.Pool.ReplicaSize
+	return rw, ro
+}
+
+func outlierConfig(cfg *config.Config) pool.OutlierConfig {
+	od := cfg.Pool.OutlierDetection
+	return pool.OutlierConfig{
+		ConsecutiveFailures: od.ConsecutiveFailures,
+		ErrorRate:           od.ErrorRate,
+		LatencyFactor:       od.LatencyFactor,
+		EjectionTime:        od.EjectionTime,
+		MaxEjectionPercent:  od.MaxEjectionPercent,
+	}
+}
+
+func listenerConfig(cfg *config.Config) listener.ListenerConfig {
+	return listener.ListenerConfig{
+		Address:        cfg.Listener.Address,
+		MaxConnections: cfg.Listener.MaxConnections,
+		ReadTimeout:    cfg.Listener.ReadTimeout,
+		WriteTimeout:   cfg.Listener.WriteTimeout,
+	}
+}
+
+func newRouter(cfg *config.Config) (router.Routing, error) {
+	rules := make([]router.Rule, len(cfg.Routing.Rules))
+	for i, rule := range cfg.Routing.Rules {
+		rules[i] = router.Rule{
+			Group:           rule.Group,
+			User:            rule.User,
+			Database:        rule.Database,
+			ApplicationName: rule.ApplicationName,
+			Query:           rule.Query,
+		}
+	}
+	ruleRouter, err := router.NewRuleRouter(rules)
+	if err != nil {
+		return nil, err
+	}
+	return router.NewChain(ruleRouter, router.NewRouter()), nil
+}
+
+// groupBalancers creates the balancer of every replica group, the default
+// group included.
+func groupBalancers(cfg *config.Config) (map[string]pool.Balancer, error) {
+	out := make(map[string]pool.Balancer, len(cfg.Backend.Groups)+1)
+	b, err := pool.NewBalancer(cfg.Pool.Balancer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pool config: %w", err)
+	}
+	out[pool.DefaultGroup] = b
+	for _, g := range cfg.Backend.Groups {
+		b, err := pool.NewBalancer(cmp.Or(g.Balancer, cfg.Pool.Balancer))
+		if err != nil {
+			return nil, fmt.Errorf("invalid config of group %q: %w", g.Name, err)
+		}
+		out[g.Name] = b
+	}
+	return out, nil
+}
+
+// applyGroups makes the replica groups of pm match cfg. Pools of replicas
+// still configured keep their connections.
+func applyGroups(pm *pool.PoolManager, cfg *config.Config, balancers map[string]pool.Balancer) {
+	pm.SetGroup(pool.DefaultGroup, poolNodes(cfg.Backend.Replicas), cfg.Pool.ReplicaSize, balancers[pool.DefaultGroup])
+	for _, g := range cfg.Backend.Groups {
+		pm.SetGroup(g.Name, poolNodes(g.Replicas), cmp.Or(g.PoolSize, cfg.Pool.ReplicaSize), balancers[g.Name])
+	}
+	for _, name := range pm.GroupNames() {
+		if _, ok := balancers[name]; !ok {
+			pm.RemoveGroup(name)
+		}
+	}
+}
+
+func poolNodes(nodes []config.BackendNode) []pool.Node {
+	out := make([]pool.Node, len(nodes))
+	for i, n := range nodes {
+		out[i] = pool.Node{Address: n.Address, Weight: n.Weight}
+	}
+	return out
+}
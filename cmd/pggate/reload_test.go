@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/listener"
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/proxy"
+)
+
+// fakeReplicas returns the addresses of n listeners that accept connections
+// and never answer, enough for pools to hand them out.
+func fakeReplicas(t *testing.T, n int) []string {
+	t.Helper()
+	addrs := make([]string, n)
+	for i := range addrs {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				t.Cleanup(func() { conn.Close() })
+			}
+		}()
+		addrs[i] = ln.Addr().String()
+	}
+	return addrs
+}
+
+// newTestReloader wires a reloader to the components as main does.
+func newTestReloader(t *testing.T, path string) *reloader {
+	t.Helper()
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	rwCfg, roCfg := poolConfigs(cfg)
+	pm := pool.NewPoolManagerWithConfig(cfg.Backend.Primary.Address, poolNodes(cfg.Backend.Replicas), rwCfg, roCfg)
+	t.Cleanup(pm.Close)
+	balancers, err := groupBalancers(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyGroups(pm, cfg, balancers)
+	r, err := newRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := &reloader{path: path, started: cfg, pm: pm}
+	rl.current.Store(cfg)
+	rl.proxy = proxy.NewProxy(rl.proxyConfig(cfg), pm, r)
+	rl.listener = listener.NewServer(listenerConfig(cfg), rl.proxy)
+	return rl
+}
+
+// picks returns the addresses of n replicas picked from group for key.
+func picks(t *testing.T, pm *pool.PoolManager, group, key string, n int) []string {
+	t.Helper()
+	var out []string
+	for range n {
+		conn, p, err := pm.GetROGroup(group, key)
+		if err != nil {
+			t.Fatalf("GetROGroup(%q) error = %v", group, err)
+		}
+		pm.PutRO(conn, p)
+		out = append(out, p.Address())
+	}
+	return out
+}
+
+func groupAddresses(pm *pool.PoolManager, group string) []string {
+	var out []string
+	for _, s := range pm.Stats() {
+		if s.Role == "replica" && s.Group == group {
+			out = append(out, s.Address)
+		}
+	}
+	return out
+}
+
+func TestReloader_Reload(t *testing.T) {
+	replicas := fakeReplicas(t, 2)
+	base := `
+listener:
+  address: "127.0.0.1:6432"
+backend:
+  primary:
+    address: "127.0.0.1:1"
+  replicas:
+    - address: "` + replicas[0] + `"
+  groups:
+    - name: bi
+      balancer: round_robin
+      replicas:
+        - address: "` + replicas[0] + `"
+        - address: "` + replicas[1] + `"
+pool:
+  hash_key: user
+`
+	tests := []struct {
+		name        string
+		next        string
+		wantErr     string
+		wantRestart []string
+		check       func(t *testing.T, rl *reloader)
+	}{
+		{
+			name: "group removed",
+			next: strings.Split(base, "  groups:")[0] + "pool:\n  hash_key: user\n",
+			check: func(t *testing.T, rl *reloader) {
+				if got := rl.pm.GroupNames(); !slices.Equal(got, []string{pool.DefaultGroup}) {
+					t.Errorf("GroupNames() = %q, want only the default group", got)
+				}
+				if got := groupAddresses(rl.pm, pool.DefaultGroup); !slices.Equal(got, replicas[:1]) {
+					t.Errorf("default group replicas = %q, want %q", got, replicas[:1])
+				}
+			},
+		},
+		{
+			name: "balancer swapped",
+			next: strings.Replace(base, "balancer: round_robin", "balancer: consistent_hash", 1),
+			check: func(t *testing.T, rl *reloader) {
+				got := picks(t, rl.pm, "bi", "alice", 4)
+				if got[0] != got[1] || got[1] != got[2] || got[2] != got[3] {
+					t.Errorf("consistent_hash picks for one key = %q, want the same replica", got)
+				}
+				if got := groupAddresses(rl.pm, "bi"); !slices.Equal(got, replicas) {
+					t.Errorf("bi replicas = %q, want %q", got, replicas)
+				}
+			},
+		},
+		{
+			name:        "listener address changed",
+			next:        strings.Replace(base, "127.0.0.1:6432", "127.0.0.1:6433", 1),
+			wantRestart: []string{"listener.address"},
+		},
+		{
+			name:    "invalid file",
+			next:    strings.Replace(base, "hash_key: user", "hash_key: user\n  balancer: random", 1),
+			wantErr: `pool.balancer: unknown value "random"`,
+			check: func(t *testing.T, rl *reloader) {
+				if got := rl.pm.GroupNames(); !slices.Equal(got, []string{pool.DefaultGroup, "bi"}) {
+					t.Errorf("GroupNames() = %q after a failed reload, want them unchanged", got)
+				}
+				got := picks(t, rl.pm, "bi", "alice", 2)
+				if got[0] == got[1] {
+					t.Errorf("round_robin picks = %q after a failed reload, want both replicas", got)
+				}
+				if rl.current.Load() != rl.started {
+					t.Error("failed reload replaced the running configuration")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, base)
+			rl := newTestReloader(t, path)
+			if got := picks(t, rl.pm, "bi", "alice", 2); got[0] == got[1] {
+				t.Fatalf("round_robin picks before reload = %q, want both replicas", got)
+			}
+
+			if err := os.WriteFile(path, []byte(tt.next), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			restart, err := rl.reload()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("reload() error = %v, want %q", err, tt.wantErr)
+			}
+			if !slices.Equal(restart, tt.wantRestart) {
+				t.Errorf("reload() restart = %q, want %q", restart, tt.wantRestart)
+			}
+			if tt.check != nil {
+				tt.check(t, rl)
+			}
+		})
+	}
+}
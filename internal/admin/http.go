@@ -0,0 +1,233 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/pggate/internal/listener"
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/proxy"
+)
+
+// Handler serves the JSON admin API and the health probes next to the
+// metrics endpoint. Routes that change state require the admin.http_token
+// bearer token.
+type Handler struct {
+	pm       *pool.PoolManager
+	proxy    *proxy.Proxy
+	listener *listener.Server
+	mux      *http.ServeMux
+}
+
+func NewHandler(pm *pool.PoolManager, p *proxy.Proxy, l *listener.Server) *Handler {
+	h := &Handler{pm: pm, proxy: p, listener: l, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /admin/pools", h.backends)
+	h.mux.HandleFunc("GET /admin/backends", h.backends)
+	h.mux.HandleFunc("POST /admin/backends/{address}/drain", h.authorized(h.drain))
+	h.mux.HandleFunc("GET /admin/sessions", h.sessions)
+	h.mux.HandleFunc("DELETE /admin/sessions/{id}", h.authorized(h.kill))
+	h.mux.HandleFunc("POST /admin/reload", h.authorized(h.reload))
+	h.mux.HandleFunc("POST /admin/pause", h.authorized(h.pause))
+	h.mux.HandleFunc("POST /admin/resume", h.authorized(h.resume))
+	h.mux.HandleFunc("GET /admin/clients", h.clientStats)
+	h.mux.HandleFunc("GET /admin/queries", h.queryStats)
+	h.mux.HandleFunc("GET /healthz", h.healthz)
+	h.mux.HandleFunc("GET /readyz", h.readyz)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized guards a route that changes state: the request must carry the
+// configured token as "Authorization: Bearer <token>", and without a token
+// the route is refused.
+func (h *Handler) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := h.proxy.HTTPToken()
+		if token == "" {
+			writeError(w, http.StatusForbidden, errors.New("disabled, set admin.http_token to enable"))
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pggate"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// backends lists every backend node with its health and pool statistics.
+func (h *Handler) backends(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.pm.Stats())
+}
+
+// drain takes a replica out of rotation, waits for its connections to be
+// returned for up to ?timeout= (default admin.drain_timeout) and removes it.
+func (h *Handler) drain(w http.ResponseWriter, r *http.Request) {
+	address := r.PathValue("address")
+	timeout, ok := timeoutParam(w, r, h.proxy.DrainTimeout())
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	err := h.pm.Remove(ctx, address)
+	switch {
+	case errors.Is(err, pool.ErrUnknownBackend):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, pool.ErrDrainPrimary):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeJSON(w, http.StatusGatewayTimeout, map[string]string{"backend": address, "status": "removed", "error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"backend": address, "status": "removed"})
+	}
+}
+
+func (h *Handler) sessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.proxy.Sessions())
+}
+
+func (h *Handler) kill(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid session id"))
+		return
+	}
+	if !h.proxy.KillSession(id) {
+		writeError(w, http.StatusNotFound, errors.New("no such session"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "status": "killed"})
+}
+
+type reloadResult struct {
+	Status string `json:"status"`
+	// RestartRequired lists changed settings that only apply after a
+	// restart.
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+func (h *Handler) reload(w http.ResponseWriter, r *http.Request) {
+	restart, err := h.proxy.Reload()
+	switch {
+	case errors.Is(err, proxy.ErrReloadUnavailable):
+		writeError(w, http.StatusNotImplemented, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, reloadResult{Status: "reloaded", RestartRequired: restart})
+	}
+}
+
+// pause holds new queries and waits for in-flight transactions for up to
+// ?timeout=, a Go duration defaulting to admin.pause_timeout.
+func (h *Handler) pause(w http.ResponseWriter, r *http.Request) {
+	timeout, ok := timeoutParam(w, r, h.proxy.PauseTimeout())
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	if err := h.proxy.Pause(ctx); err != nil {
+		writeJSON(w, http.StatusGatewayTimeout, map[string]string{"status": "pausing", "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "paused"})
+}
+
+func (h *Handler) resume(w http.ResponseWriter, r *http.Request) {
+	h.proxy.Resume()
+	writeJSON(w, http.StatusOK, map[string]string{"status": "resumed"})
+}
+
+func (h *Handler) clientStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.proxy.ClientStats().Snapshot())
+}
+
+// queryStats lists query fingerprints by descending total time, limited to
+// the first ?limit= entries.
+func (h *Handler) queryStats(w http.ResponseWriter, r *http.Request) {
+	qs := h.proxy.QueryStats().Snapshot()
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+		qs = qs[:min(n, len(qs))]
+	}
+	writeJSON(w, http.StatusOK, qs)
+}
+
+// health is the body of the probe endpoints.
+type health struct {
+	Status   string `json:"status"` // ok or unavailable
+	Listener bool   `json:"listener"`
+	Primary  string `json:"primary,omitempty"` // why the primary is unreachable
+}
+
+// healthz is the liveness probe: PgGate is alive while it accepts client
+// connections.
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	st := health{Status: "ok", Listener: h.listener.Running()}
+	if !st.Listener {
+		st.Status = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, st)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// readyz is the readiness probe: PgGate can serve queries when it accepts
+// client connections and the primary is reachable.
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	st := health{Status: "ok", Listener: h.listener.Running()}
+	if err := h.pm.RWPool.Check(); err != nil {
+		st.Primary = err.Error()
+	}
+	if !st.Listener || st.Primary != "" {
+		st.Status = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, st)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// timeoutParam parses the ?timeout= duration, answering 400 when it is
+// invalid.
+func timeoutParam(w http.ResponseWriter, r *http.Request, def time.Duration) (time.Duration, bool) {
+	v := r.URL.Query().Get("timeout")
+	if v == "" {
+		return def, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid timeout"))
+		return 0, false
+	}
+	return d, true
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("error writing admin response", "err", err)
+	}
+}
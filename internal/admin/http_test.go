@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/listener"
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/proxy"
+	"github.com/user/pggate/internal/router"
+)
+
+func startBackend(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func newTestHandler(t *testing.T, primary, replica string, reload func() ([]string, error)) *Handler {
+	t.Helper()
+	pm := pool.NewPoolManager(primary, []pool.Node{{Address: replica}}, 2, 2, time.Minute)
+	t.Cleanup(pm.Close)
+	p := proxy.NewProxy(proxy.ProxyConfig{Admin: proxy.AdminConfig{HTTPToken: testToken, Reload: reload}}, pm, router.NewRouter())
+	l := listener.NewServer(listener.ListenerConfig{Address: "127.0.0.1:0", MaxConnections: 1}, p)
+	go l.Start()
+	t.Cleanup(l.Stop)
+	for deadline := time.Now().Add(time.Second); !l.Running(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("listener did not start")
+		}
+	}
+	return NewHandler(pm, p, l)
+}
+
+const testToken = "secret"
+
+// serve sends an authorized request to h.
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	return serveAuth(h, method, target, "Bearer "+testToken)
+}
+
+func serveAuth(h http.Handler, method, target, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	replica := startBackend(t)
+	reloaded := 0
+	h := newTestHandler(t, startBackend(t), replica, func() ([]string, error) { reloaded++; return nil, nil })
+
+	tests := []struct {
+		method, target string
+		status         int
+	}{
+		{"GET", "/healthz", http.StatusOK},
+		{"GET", "/readyz", http.StatusOK},
+		{"GET", "/admin/sessions", http.StatusOK},
+		{"DELETE", "/admin/sessions/42", http.StatusNotFound},
+		{"DELETE", "/admin/sessions/abc", http.StatusBadRequest},
+		{"POST", "/admin/backends/127.0.0.1:1/drain", http.StatusNotFound},
+		{"POST", "/admin/backends/" + replica + "/drain?timeout=x", http.StatusBadRequest},
+		{"POST", "/admin/backends/" + replica + "/drain", http.StatusOK},
+		{"POST", "/admin/reload", http.StatusOK},
+		{"POST", "/admin/pause?timeout=x", http.StatusBadRequest},
+		{"POST", "/admin/pause?timeout=1s", http.StatusOK},
+		{"GET", "/readyz", http.StatusOK},
+		{"POST", "/admin/resume", http.StatusOK},
+		{"GET", "/admin/reload", http.StatusMethodNotAllowed},
+		{"GET", "/admin/queries?limit=x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serve(h, tt.method, tt.target); rec.Code != tt.status {
+			t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.target, rec.Code, tt.status, rec.Body)
+		}
+	}
+	if reloaded != 1 {
+		t.Errorf("reload called %d times, want 1", reloaded)
+	}
+
+	var backends []pool.NodeStats
+	if err := json.NewDecoder(serve(h, "GET", "/admin/backends").Body).Decode(&backends); err != nil {
+		t.Fatal(err)
+	}
+	if len(backends) != 1 || backends[0].Role != pool.RolePrimary {
+		t.Errorf("GET /admin/backends = %+v, want only the primary after draining the replica", backends)
+	}
+}
+
+func TestHandler_NotReady(t *testing.T) {
+	h := newTestHandler(t, "127.0.0.1:1", startBackend(t), nil)
+
+	rec := serve(h, "GET", "/readyz")
+	var st health
+	json.NewDecoder(rec.Body).Decode(&st)
+	if rec.Code != http.StatusServiceUnavailable || st.Primary == "" || !st.Listener {
+		t.Errorf("GET /readyz = %d %+v, want 503 with the primary error", rec.Code, st)
+	}
+	if rec := serve(h, "POST", "/admin/reload"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("POST /admin/reload without reload = %d, want 501", rec.Code)
+	}
+
+	h.listener.Stop()
+	if rec := serve(h, "GET", "/healthz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /healthz after Stop = %d, want 503", rec.Code)
+	}
+}
+
+func TestHandler_Auth(t *testing.T) {
+	reloaded := 0
+	h := newTestHandler(t, startBackend(t), startBackend(t), func() ([]string, error) { reloaded++; return nil, nil })
+
+	tests := []struct {
+		method, target, authorization string
+		status                        int
+	}{
+		{"POST", "/admin/reload", "", http.StatusUnauthorized},
+		{"POST", "/admin/reload", "Bearer wrong", http.StatusUnauthorized},
+		{"POST", "/admin/reload", testToken, http.StatusUnauthorized},
+		{"POST", "/admin/pause", "", http.StatusUnauthorized},
+		{"POST", "/admin/resume", "", http.StatusUnauthorized},
+		{"DELETE", "/admin/sessions/42", "", http.StatusUnauthorized},
+		{"POST", "/admin/backends/127.0.0.1:1/drain", "", http.StatusUnauthorized},
+		{"GET", "/admin/sessions", "", http.StatusOK},
+		{"GET", "/readyz", "", http.StatusOK},
+		{"POST", "/admin/reload", "Bearer " + testToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := serveAuth(h, tt.method, tt.target, tt.authorization); rec.Code != tt.status {
+			t.Errorf("%s %s with %q = %d, want %d: %s", tt.method, tt.target, tt.authorization, rec.Code, tt.status, rec.Body)
+		}
+	}
+	if reloaded != 1 {
+		t.Errorf("reload called %d times, want 1", reloaded)
+	}
+
+	h.proxy.SetConfig(proxy.ProxyConfig{})
+	if rec := serve(h, "POST", "/admin/reload"); rec.Code != http.StatusForbidden {
+		t.Errorf("POST /admin/reload without admin.http_token = %d, want 403", rec.Code)
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"time"
 
@@ -11,6 +13,41 @@ type Config struct {
 	Listener ListenerConfig `yaml:"listener"`
 	Backend  BackendConfig  `yaml:"backend"`
 	Pool     PoolConfig     `yaml:"pool"`
+	Routing  RoutingConfig  `yaml:"routing"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Stats    StatsConfig    `yaml:"stats"`
+
+	SlowQueryLog SlowQueryLogConfig `yaml:"slow_query_log"`
+	Logging      LoggingConfig      `yaml:"logging"`
+	Tracing      TracingConfig      `yaml:"tracing"`
+	Admin        AdminConfig        `yaml:"admin"`
+}
+
+// AdminConfig controls the admin console, a virtual database served by
+// PgGate itself over the Postgres protocol.
+type AdminConfig struct {
+	Database string   `yaml:"database"` // defaults to pggate
+	Users    []string `yaml:"users"`    // allowed users; none disables the console
+	Password string   `yaml:"password"` // cleartext password required when set
+	// HTTPToken is the bearer token of the admin API routes that change
+	// state; none disables them.
+	HTTPToken string `yaml:"http_token"`
+	// PauseTimeout bounds how long PAUSE waits for in-flight transactions.
+	PauseTimeout time.Duration `yaml:"pause_timeout"`
+}
+
+// TracingConfig enables OTLP span export when Endpoint is set.
+type TracingConfig struct {
+	Endpoint    string   `yaml:"endpoint"` // OTLP/HTTP traces URL
+	ServiceName string   `yaml:"service_name"`
+	SampleRatio *float64 `yaml:"sample_ratio"` // defaults to DefaultSampleRatio; 0 keeps only client-sampled traces
+}
+
+type LoggingConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // text or json
+	// Queries logs every query's text: "" (off), "redacted" or "full".
+	Queries string `yaml:"queries"`
 }
 
 type ListenerConfig struct {
@@ -18,32 +55,143 @@ type ListenerConfig struct {
 	MaxConnections int           `yaml:"max_connections"`
 	ReadTimeout    time.Duration `yaml:"read_timeout"`
 	WriteTimeout   time.Duration `yaml:"write_timeout"`
+	// ShutdownTimeout bounds how long shutdown waits for open transactions
+	// before closing the remaining client connections.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type MetricsConfig struct {
+	Address string `yaml:"address"` // defaults to :8080
+}
+
+// SlowQueryLogConfig enables the JSON slow query log when Threshold is set.
+type SlowQueryLogConfig struct {
+	Threshold time.Duration `yaml:"threshold"`
+	Path      string        `yaml:"path"` // file, stdout (default) or stderr
+	Redact    bool          `yaml:"redact"`
+}
+
+type StatsConfig struct {
+	// MaxClients bounds the user/database/application_name combinations
+	// tracked; further ones are aggregated as "__other__".
+	MaxClients int `yaml:"max_clients"`
+	// MaxQueries bounds the normalized query fingerprints tracked.
+	MaxQueries int `yaml:"max_queries"`
 }
 
 type BackendConfig struct {
-	Primary  BackendNode   `yaml:"primary"`
+	Primary  BackendNode    `yaml:"primary"`
+	Replicas []BackendNode  `yaml:"replicas"`
+	Groups   []BackendGroup `yaml:"groups"`
+}
+
+// BackendGroup is a named set of replicas with its own pools, targeted by
+// routing rules or query hints.
+type BackendGroup struct {
+	Name     string        `yaml:"name"`
 	Replicas []BackendNode `yaml:"replicas"`
+	PoolSize int           `yaml:"pool_size"` // defaults to pool.replica_size
+	Balancer string        `yaml:"balancer"`  // defaults to pool.balancer
 }
 
 type BackendNode struct {
 	Address string `yaml:"address"`
+	Weight  int    `yaml:"weight"` // relative share of replica traffic, defaults to 1
 }
 
 type PoolConfig struct {
-	PrimarySize int `yaml:"primary_size"`
-	ReplicaSize int `yaml:"replica_size"`
+	PrimarySize    int           `yaml:"primary_size"` // hard cap on open connections per primary pool
+	ReplicaSize    int           `yaml:"replica_size"` // hard cap on open connections per replica pool
+	AcquireTimeout time.Duration `yaml:"acquire_timeout"`
+	MinIdle        int           `yaml:"min_idle"`          // idle connections kept ready per pool
+	MaxIdle        int           `yaml:"max_idle"`          // idle connections kept at most per pool
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`      // close idle connections above min_idle after this
+	MaxLifetime    time.Duration `yaml:"max_conn_lifetime"` // recycle connections after this, with jitter
+	DrainTimeout   time.Duration `yaml:"drain_timeout"`     // wait this long for a removed replica's connections
+
+	PingIdleThreshold time.Duration   `yaml:"ping_idle_threshold"` // ping connections idle longer than this before use
+	KeepAlive         KeepAliveConfig `yaml:"keepalive"`
+	Balancer          string          `yaml:"balancer"` // round_robin, least_conn, p2c or consistent_hash
+	HashKey           string          `yaml:"hash_key"` // client key for consistent_hash: user, database, application_name or client_addr
+	Sticky            string          `yaml:"sticky"`   // keep reads on one replica per session, user or application_name
+
+	OutlierDetection OutlierConfig `yaml:"outlier_detection"`
 }
 
+// KeepAliveConfig sets TCP keepalive on backend connections. Zero values use
+// Go's defaults: 15s idle, 15s interval, 9 probes.
+type KeepAliveConfig struct {
+	Idle     time.Duration `yaml:"idle"`
+	Interval time.Duration `yaml:"interval"`
+	Count    int           `yaml:"count"`
+}
+
+// OutlierConfig controls temporary ejection of slow or failing replicas.
+// Zero values use the built-in defaults.
+type OutlierConfig struct {
+	ConsecutiveFailures int           `yaml:"consecutive_failures"`
+	ErrorRate           float64       `yaml:"error_rate"`
+	LatencyFactor       float64       `yaml:"latency_factor"`
+	EjectionTime        time.Duration `yaml:"ejection_time"`
+	MaxEjectionPercent  int           `yaml:"max_ejection_percent"`
+}
+
+type RoutingConfig struct {
+	Rules []RoutingRule `yaml:"rules"`
+}
+
+// RoutingRule sends read-only queries matching every non-empty field to Group.
+type RoutingRule struct {
+	Group           string `yaml:"group"`
+	User            string `yaml:"user"`
+	Database        string `yaml:"database"`
+	ApplicationName string `yaml:"application_name"`
+	Query           string `yaml:"query"` // regular expression
+}
+
+// Load reads a configuration file. ${NAME} and ${NAME:-default} in values
+// are replaced from the environment, PGGATE_* variables override settings,
+// and defaults are applied before the result is validated.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	cfg, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
 
+// parse is Load for configuration already read.
+func parse(data []byte) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if len(doc.Content) > 0 {
+		if err := expandEnv(&doc); err != nil {
+			return nil, err
+		}
+		// decode the expanded document strictly, so typos in keys are reported
+		expanded, err := yaml.Marshal(&doc)
+		if err != nil {
+			return nil, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(expanded))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnvOverrides(&cfg); err != nil {
+		return nil, err
+	}
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
-
 	return &cfg, nil
-}
\ No newline at end of file
+}
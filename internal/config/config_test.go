@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -70,3 +72,228 @@ func TestLoad_FileNotFound(t *testing.T) {
 		t.Error("Load() expected error for non-existent file, got nil")
 	}
 }
+
+func TestLoad_GroupsAndRules(t *testing.T) {
+	yamlContent := `
+backend:
+  primary:
+    address: "localhost:5433"
+  groups:
+    - name: analytics
+      pool_size: 5
+      replicas:
+        - address: "localhost:5440"
+routing:
+  rules:
+    - group: analytics
+      application_name: metabase
+`
+	tmpfile, err := os.CreateTemp("", "config*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(yamlContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(cfg.Backend.Groups) != 1 {
+		t.Fatalf("len(cfg.Backend.Groups) = %v, want %v", len(cfg.Backend.Groups), 1)
+	}
+	g := cfg.Backend.Groups[0]
+	if g.Name != "analytics" || g.PoolSize != 5 || len(g.Replicas) != 1 {
+		t.Errorf("cfg.Backend.Groups[0] = %+v, want analytics with one replica and pool_size 5", g)
+	}
+	if len(cfg.Routing.Rules) != 1 || cfg.Routing.Rules[0].ApplicationName != "metabase" {
+		t.Errorf("cfg.Routing.Rules = %+v, want one rule for metabase", cfg.Routing.Rules)
+	}
+}
+
+func TestConfig_Settings(t *testing.T) {
+	cfg := &Config{
+		Listener: ListenerConfig{Address: ":5432", ReadTimeout: 30 * time.Second},
+		Backend:  BackendConfig{Replicas: []BackendNode{{Address: "r1:5432", Weight: 2}}},
+	}
+	cfg.Admin.Password = "secret"
+	settings, err := cfg.Settings()
+	if err != nil {
+		t.Fatalf("Settings() error = %v", err)
+	}
+	got := make(map[string]string)
+	for _, s := range settings {
+		got[s.Key] = s.Value
+	}
+	for key, want := range map[string]string{
+		"listener.address":           ":5432",
+		"listener.read_timeout":      "30s",
+		"backend.replicas[0].weight": "2",
+		"backend.groups":             "[]",
+		"admin.password":             "********",
+	} {
+		if got[key] != want {
+			t.Errorf("Settings()[%q] = %q, want %q", key, got[key], want)
+		}
+	}
+	if settings[0].Key != "listener.address" {
+		t.Errorf("Settings()[0] = %v, want listener.address first", settings[0])
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	prev := &Config{
+		Listener: ListenerConfig{Address: ":5432", MaxConnections: 100},
+		Backend:  BackendConfig{Primary: BackendNode{Address: "p:5432"}, Replicas: []BackendNode{{Address: "r1:5432"}}},
+	}
+	next := *prev
+	next.Listener.MaxConnections = 200
+	next.Backend.Replicas = []BackendNode{{Address: "r1:5432"}, {Address: "r2:5432"}}
+	next.Pool.PrimarySize = 20
+	next.Routing.Rules = []RoutingRule{{Group: "analytics", User: "bi"}}
+	if got, err := RestartRequired(prev, &next); err != nil || len(got) != 0 {
+		t.Errorf("RestartRequired() with reloadable changes = %v, %v, want none", got, err)
+	}
+
+	next.Listener.Address = ":6432"
+	next.Backend.Primary.Address = "p2:5432"
+	next.Metrics.Address = ":9090"
+	got, err := RestartRequired(prev, &next)
+	if err != nil {
+		t.Fatalf("RestartRequired() error = %v", err)
+	}
+	want := []string{"backend.primary.address", "listener.address", "metrics.address"}
+	if !slices.Equal(got, want) {
+		t.Errorf("RestartRequired() = %v, want %v", got, want)
+	}
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := parse([]byte("backend:\n  primary:\n    address: \"localhost:5433\"\n"))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if cfg.Listener.Address != DefaultListenAddress || cfg.Listener.MaxConnections != DefaultMaxConnections {
+		t.Errorf("listener = %+v, want the defaults", cfg.Listener)
+	}
+	if cfg.Listener.ReadTimeout != DefaultReadTimeout || cfg.Listener.WriteTimeout != DefaultWriteTimeout {
+		t.Errorf("listener timeouts = %v, %v, want the defaults", cfg.Listener.ReadTimeout, cfg.Listener.WriteTimeout)
+	}
+	if cfg.Listener.ShutdownTimeout != DefaultShutdownTimeout {
+		t.Errorf("cfg.Listener.ShutdownTimeout = %v, want %v", cfg.Listener.ShutdownTimeout, DefaultShutdownTimeout)
+	}
+	if cfg.Metrics.Address != DefaultMetricsAddress {
+		t.Errorf("cfg.Metrics.Address = %v, want %v", cfg.Metrics.Address, DefaultMetricsAddress)
+	}
+	if r := cfg.Tracing.SampleRatio; r == nil || *r != DefaultSampleRatio {
+		t.Errorf("cfg.Tracing.SampleRatio = %v, want %v", r, DefaultSampleRatio)
+	}
+	if cfg.Pool.PrimarySize != DefaultPrimarySize || cfg.Pool.ReplicaSize != DefaultReplicaSize {
+		t.Errorf("pool sizes = %d, %d, want %d, %d", cfg.Pool.PrimarySize, cfg.Pool.ReplicaSize, DefaultPrimarySize, DefaultReplicaSize)
+	}
+
+	// an explicit zero is kept
+	cfg, err = parse([]byte("backend:\n  primary:\n    address: \"localhost:5433\"\ntracing:\n  sample_ratio: 0\n"))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if r := cfg.Tracing.SampleRatio; r == nil || *r != 0 {
+		t.Errorf("cfg.Tracing.SampleRatio = %v with sample_ratio: 0, want 0", r)
+	}
+}
+
+func TestLoad_Env(t *testing.T) {
+	t.Setenv("PRIMARY_HOST", "db1")
+	t.Setenv("MAX_CONNS", "50")
+	t.Setenv("PGGATE_POOL_PRIMARY_SIZE", "7")
+	t.Setenv("PGGATE_BACKEND_PRIMARY_ADDRESS", "db2:5432")
+	t.Setenv("PGGATE_ADMIN_USERS", "[admin, ops]")
+	t.Setenv("PGGATE_LISTENER_READ_TIMEOUT", "1m")
+
+	cfg, err := parse([]byte(`
+listener:
+  max_connections: ${MAX_CONNS}
+  address: "${LISTEN_HOST:-127.0.0.1}:6432"
+backend:
+  primary:
+    address: "${PRIMARY_HOST}:5432"
+  replicas:
+    - address: "${PRIMARY_HOST}:5434"
+pool:
+  primary_size: 20
+`))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if cfg.Listener.MaxConnections != 50 || cfg.Listener.Address != "127.0.0.1:6432" {
+		t.Errorf("listener = %+v, want interpolated values", cfg.Listener)
+	}
+	if cfg.Backend.Replicas[0].Address != "db1:5434" {
+		t.Errorf("cfg.Backend.Replicas[0].Address = %v, want %v", cfg.Backend.Replicas[0].Address, "db1:5434")
+	}
+	if cfg.Backend.Primary.Address != "db2:5432" || cfg.Pool.PrimarySize != 7 || cfg.Listener.ReadTimeout != time.Minute {
+		t.Errorf("overrides not applied: primary %v, primary_size %v, read_timeout %v", cfg.Backend.Primary.Address, cfg.Pool.PrimarySize, cfg.Listener.ReadTimeout)
+	}
+	if !slices.Equal(cfg.Admin.Users, []string{"admin", "ops"}) {
+		t.Errorf("cfg.Admin.Users = %v, want [admin ops]", cfg.Admin.Users)
+	}
+
+	_, err = parse([]byte("backend:\n  primary:\n    address: \"${PGGATE_TEST_UNSET}\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "PGGATE_TEST_UNSET is not set") {
+		t.Errorf("parse() with an unset variable error = %v", err)
+	}
+	t.Setenv("PGGATE_POOL_REPLICA_SIZE", "many")
+	if _, err := parse([]byte("backend:\n  primary:\n    address: \"db:5432\"\n")); err == nil || !strings.Contains(err.Error(), "PGGATE_POOL_REPLICA_SIZE") {
+		t.Errorf("parse() with an invalid override error = %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string // substring of the error, empty for valid
+	}{
+		{"valid", "", ""},
+		{"missing primary", "backend: {primary: {address: ''}}", "backend.primary.address: is required"},
+		{"bad address", "listener: {address: '5432'}", `listener.address: "5432" is not a host:port address`},
+		{"negative max connections", "listener: {max_connections: -1}", "listener.max_connections: must be positive, got -1"},
+		{"negative primary size", "pool: {primary_size: -1}", "pool.primary_size: must be positive, got -1"},
+		{"negative replica size", "pool: {replica_size: -5}", "pool.replica_size: must be positive, got -5"},
+		{"negative timeout", "listener: {read_timeout: -1s}", "listener.read_timeout: must not be negative"},
+		{"unknown balancer", "pool: {balancer: random}", `pool.balancer: unknown value "random"`},
+		{"unknown hash key", "pool: {hash_key: client_encoding}", `pool.hash_key: unknown value "client_encoding"`},
+		{"unknown sticky", "pool: {sticky: database}", `pool.sticky: unknown value "database"`},
+		{"consistent hash without key", "pool: {balancer: consistent_hash}", "pool.balancer: consistent_hash requires pool.hash_key"},
+		{"consistent hash", "pool: {balancer: consistent_hash, hash_key: user}", ""},
+		{"group consistent hash without key", "backend: {primary: {address: 'p:5432'}, groups: [{name: bi, balancer: consistent_hash}]}", "backend.groups[0].balancer: consistent_hash requires pool.hash_key"},
+		{"unknown log level", "logging: {level: verbose}", "logging.level"},
+		{"sample ratio", "tracing: {sample_ratio: 2}", "tracing.sample_ratio: must be between 0 and 1"},
+		{"unknown group", "routing: {rules: [{group: bi}]}", `routing.rules[0].group: unknown group "bi"`},
+		{"bad query", "backend: {primary: {address: 'p:5432'}, groups: [{name: bi}]}\nrouting: {rules: [{group: bi, query: '('}]}", "routing.rules[0].query"},
+		{"duplicate group", "backend: {primary: {address: 'p:5432'}, groups: [{name: bi}, {name: bi}]}", `backend.groups[1].name: duplicate group "bi"`},
+		{"unknown key", "listener: {max_conection: 10}", "field max_conection not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.yaml
+			if !strings.Contains(data, "backend:") {
+				data = "backend: {primary: {address: 'p:5432'}}\n" + data
+			}
+			_, err := parse([]byte(data))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("parse() error = %v, want nil", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// reloadable are the settings, as key prefixes of Settings, that a reload
+// applies to the running proxy.
+var reloadable = []string{
+	"listener.max_connections",
+	"listener.read_timeout",
+	"listener.write_timeout",
+	"listener.shutdown_timeout",
+	"backend.replicas",
+	"backend.groups",
+	"pool.",
+	"routing.",
+	"logging.level",
+	"logging.queries",
+	"admin.",
+}
+
+// RestartRequired lists the settings that differ between prev and next but
+// only take effect after a restart, such as listener.address.
+func RestartRequired(prev, next *Config) ([]string, error) {
+	before, err := prev.Settings()
+	if err != nil {
+		return nil, err
+	}
+	after, err := next.Settings()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(before))
+	for _, s := range before {
+		values[s.Key] = s.Value
+	}
+	var out []string
+	for _, s := range after {
+		if v, ok := values[s.Key]; !ok || v != s.Value {
+			out = append(out, s.Key)
+		}
+		delete(values, s.Key)
+	}
+	for key := range values {
+		out = append(out, key)
+	}
+	out = slices.DeleteFunc(out, func(key string) bool {
+		return slices.ContainsFunc(reloadable, func(prefix string) bool { return strings.HasPrefix(key, prefix) })
+	})
+	slices.Sort(out)
+	return out, nil
+}
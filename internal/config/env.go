@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables that override settings, such
+// as PGGATE_LISTENER_MAX_CONNECTIONS for listener.max_connections.
+const EnvPrefix = "PGGATE_"
+
+// envRef matches ${NAME} and ${NAME:-default}.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces environment variable references in the values of the
+// YAML document n. A reference to an unset variable without a default is an
+// error.
+func expandEnv(n *yaml.Node) error {
+	var errs []error
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "${") {
+			n.Value = envRef.ReplaceAllStringFunc(n.Value, func(ref string) string {
+				m := envRef.FindStringSubmatch(ref)
+				if v, ok := os.LookupEnv(m[1]); ok {
+					return v
+				}
+				if strings.Contains(ref, ":-") {
+					return m[2]
+				}
+				errs = append(errs, fmt.Errorf("line %d: environment variable %s is not set", n.Line, m[1]))
+				return ref
+			})
+			if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0 {
+				n.Tag = "" // resolve numbers and durations from the expanded value
+			}
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(n)
+	return errors.Join(errs...)
+}
+
+// applyEnvOverrides sets the settings of cfg named by PGGATE_* environment
+// variables. Values are parsed as YAML, so lists can be given in flow style:
+// PGGATE_ADMIN_USERS="[admin, ops]".
+func applyEnvOverrides(cfg *Config) error {
+	var errs []error
+	var walk func(v reflect.Value, key string)
+	walk = func(v reflect.Value, key string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if key != "" {
+				name = key + "_" + name
+			}
+			f := v.Field(i)
+			if f.Kind() == reflect.Struct {
+				walk(f, name)
+				continue
+			}
+			env := EnvPrefix + strings.ToUpper(name)
+			s, ok := os.LookupEnv(env)
+			if !ok {
+				continue
+			}
+			if f.Kind() == reflect.String {
+				f.SetString(s)
+				continue
+			}
+			if err := yaml.Unmarshal([]byte(s), f.Addr().Interface()); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", env, err))
+			}
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Setting is one leaf value of the configuration, keyed by its dotted YAML
+// path such as pool.primary_size or backend.replicas[0].address.
+type Setting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Settings flattens the configuration in file order. Secrets are masked.
+func (c *Config) Settings() ([]Setting, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var out []Setting
+	if len(doc.Content) > 0 {
+		flatten(doc.Content[0], "", &out)
+	}
+	return out, nil
+}
+
+func flatten(n *yaml.Node, prefix string, out *[]Setting) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flatten(n.Content[i+1], key, out)
+		}
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			*out = append(*out, Setting{Key: prefix, Value: "[]"})
+		}
+		for i, c := range n.Content {
+			flatten(c, fmt.Sprintf("%s[%d]", prefix, i), out)
+		}
+	default:
+		v := n.Value
+		if (strings.Contains(prefix, "password") || strings.Contains(prefix, "token")) && v != "" {
+			v = "********"
+		}
+		*out = append(*out, Setting{Key: prefix, Value: v})
+	}
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults of settings left out of the configuration file.
+const (
+	DefaultListenAddress   = ":5432"
+	DefaultMaxConnections  = 1000
+	DefaultReadTimeout     = 30 * time.Second
+	DefaultWriteTimeout    = 30 * time.Second
+	DefaultShutdownTimeout = 30 * time.Second
+	DefaultMetricsAddress  = ":8080"
+	DefaultSampleRatio     = 1.0
+	DefaultPrimarySize     = 10
+	DefaultReplicaSize     = 20
+)
+
+var (
+	balancers    = []string{"", "round_robin", "least_conn", "p2c", "consistent_hash"}
+	hashKeys     = []string{"", "user", "database", "application_name", "client_addr"}
+	stickyKeys   = []string{"", "session", "user", "application_name"}
+	logLevels    = []string{"", "debug", "info", "warn", "warning", "error"}
+	logFormats   = []string{"", "text", "json"}
+	queryLogging = []string{"", "redacted", "full"}
+)
+
+// setDefaults fills in settings whose zero value would not work.
+func (c *Config) setDefaults() {
+	if c.Listener.Address == "" {
+		c.Listener.Address = DefaultListenAddress
+	}
+	if c.Listener.MaxConnections == 0 {
+		c.Listener.MaxConnections = DefaultMaxConnections
+	}
+	if c.Listener.ReadTimeout == 0 {
+		c.Listener.ReadTimeout = DefaultReadTimeout
+	}
+	if c.Listener.WriteTimeout == 0 {
+		c.Listener.WriteTimeout = DefaultWriteTimeout
+	}
+	if c.Listener.ShutdownTimeout == 0 {
+		c.Listener.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if c.Metrics.Address == "" {
+		c.Metrics.Address = DefaultMetricsAddress
+	}
+	// zero would leave the pools without a cap
+	if c.Pool.PrimarySize == 0 {
+		c.Pool.PrimarySize = DefaultPrimarySize
+	}
+	if c.Pool.ReplicaSize == 0 {
+		c.Pool.ReplicaSize = DefaultReplicaSize
+	}
+	if c.Tracing.SampleRatio == nil {
+		ratio := DefaultSampleRatio
+		c.Tracing.SampleRatio = &ratio
+	}
+}
+
+// Validate checks the configuration after defaults are applied and reports
+// every invalid setting by its key.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	address := func(key, addr string) {
+		if addr == "" {
+			invalid(key, "is required")
+		} else if _, _, err := net.SplitHostPort(addr); err != nil {
+			invalid(key, "%q is not a host:port address", addr)
+		}
+	}
+	positive := func(key string, n int) {
+		if n <= 0 {
+			invalid(key, "must be positive, got %d", n)
+		}
+	}
+	notNegative := func(key string, n int) {
+		if n < 0 {
+			invalid(key, "must not be negative, got %d", n)
+		}
+	}
+	duration := func(key string, d time.Duration) {
+		if d < 0 {
+			invalid(key, "must not be negative, got %s", d)
+		}
+	}
+	oneOf := func(key, v string, allowed []string) {
+		if !slices.Contains(allowed, v) {
+			invalid(key, "unknown value %q, want one of %s", v, strings.Join(allowed[1:], ", "))
+		}
+	}
+	ratio := func(key string, f float64) {
+		if f < 0 || f > 1 {
+			invalid(key, "must be between 0 and 1, got %g", f)
+		}
+	}
+	nodes := func(key string, list []BackendNode) {
+		for i, n := range list {
+			address(fmt.Sprintf("%s[%d].address", key, i), n.Address)
+			notNegative(fmt.Sprintf("%s[%d].weight", key, i), n.Weight)
+		}
+	}
+
+	address("listener.address", c.Listener.Address)
+	positive("listener.max_connections", c.Listener.MaxConnections)
+	duration("listener.read_timeout", c.Listener.ReadTimeout)
+	duration("listener.write_timeout", c.Listener.WriteTimeout)
+	duration("listener.shutdown_timeout", c.Listener.ShutdownTimeout)
+
+	address("backend.primary.address", c.Backend.Primary.Address)
+	nodes("backend.replicas", c.Backend.Replicas)
+	groups := make(map[string]bool)
+	for i, g := range c.Backend.Groups {
+		key := fmt.Sprintf("backend.groups[%d]", i)
+		switch {
+		case g.Name == "":
+			invalid(key+".name", "is required")
+		case groups[g.Name]:
+			invalid(key+".name", "duplicate group %q", g.Name)
+		}
+		groups[g.Name] = true
+		nodes(key+".replicas", g.Replicas)
+		notNegative(key+".pool_size", g.PoolSize)
+		oneOf(key+".balancer", g.Balancer, balancers)
+		if g.Balancer == "consistent_hash" && c.Pool.HashKey == "" {
+			invalid(key+".balancer", "consistent_hash requires pool.hash_key")
+		}
+	}
+
+	p := c.Pool
+	positive("pool.primary_size", p.PrimarySize)
+	positive("pool.replica_size", p.ReplicaSize)
+	notNegative("pool.min_idle", p.MinIdle)
+	notNegative("pool.max_idle", p.MaxIdle)
+	duration("pool.acquire_timeout", p.AcquireTimeout)
+	duration("pool.idle_timeout", p.IdleTimeout)
+	duration("pool.max_conn_lifetime", p.MaxLifetime)
+	duration("pool.drain_timeout", p.DrainTimeout)
+	duration("pool.ping_idle_threshold", p.PingIdleThreshold)
+	duration("pool.keepalive.idle", p.KeepAlive.Idle)
+	duration("pool.keepalive.interval", p.KeepAlive.Interval)
+	notNegative("pool.keepalive.count", p.KeepAlive.Count)
+	oneOf("pool.balancer", p.Balancer, balancers)
+	oneOf("pool.hash_key", p.HashKey, hashKeys)
+	oneOf("pool.sticky", p.Sticky, stickyKeys)
+	if p.Balancer == "consistent_hash" && p.HashKey == "" {
+		invalid("pool.balancer", "consistent_hash requires pool.hash_key")
+	}
+	od := p.OutlierDetection
+	notNegative("pool.outlier_detection.consecutive_failures", od.ConsecutiveFailures)
+	ratio("pool.outlier_detection.error_rate", od.ErrorRate)
+	if od.LatencyFactor < 0 {
+		invalid("pool.outlier_detection.latency_factor", "must not be negative, got %g", od.LatencyFactor)
+	}
+	duration("pool.outlier_detection.ejection_time", od.EjectionTime)
+	if od.MaxEjectionPercent < 0 || od.MaxEjectionPercent > 100 {
+		invalid("pool.outlier_detection.max_ejection_percent", "must be between 0 and 100, got %d", od.MaxEjectionPercent)
+	}
+
+	for i, r := range c.Routing.Rules {
+		key := fmt.Sprintf("routing.rules[%d]", i)
+		if r.Group == "" {
+			invalid(key+".group", "is required")
+		} else if !groups[r.Group] {
+			invalid(key+".group", "unknown group %q", r.Group)
+		}
+		if _, err := regexp.Compile(r.Query); err != nil {
+			invalid(key+".query", "%v", err)
+		}
+	}
+
+	address("metrics.address", c.Metrics.Address)
+	notNegative("stats.max_clients", c.Stats.MaxClients)
+	notNegative("stats.max_queries", c.Stats.MaxQueries)
+	duration("slow_query_log.threshold", c.SlowQueryLog.Threshold)
+	oneOf("logging.level", strings.ToLower(c.Logging.Level), logLevels)
+	oneOf("logging.format", strings.ToLower(c.Logging.Format), logFormats)
+	oneOf("logging.queries", c.Logging.Queries, queryLogging)
+	if c.Tracing.SampleRatio != nil {
+		ratio("tracing.sample_ratio", *c.Tracing.SampleRatio)
+	}
+	duration("admin.pause_timeout", c.Admin.PauseTimeout)
+
+	return errors.Join(errs...)
+}
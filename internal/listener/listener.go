@@ -1,15 +1,19 @@
 package listener
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/user/pggate/internal/metrics"
 	"github.com/user/pggate/internal/proxy"
 )
 
+var activeConnections = metrics.NewGauge("pggate_active_client_connections", "Current number of active client connections")
+
 type ListenerConfig struct {
 	Address        string
 	MaxConnections int
@@ -18,76 +22,169 @@ type ListenerConfig struct {
 }
 
 type Server struct {
-	cfg      ListenerConfig
-	listener net.Listener
-	proxy    *proxy.Proxy
+	proxy *proxy.Proxy
 
-	sem  chan struct{}  // connection limiter
-	wg   sync.WaitGroup // graceful shutdown
-	quit chan struct{}  // stop signal
+	mu       sync.Mutex
+	cfg      ListenerConfig // see SetConfig
+	listener net.Listener
+	conns    map[net.Conn]struct{} // connections being served
+	slots    *sync.Cond            // signalled when active or the limit goes down
+	stopping bool
+
+	wg      sync.WaitGroup // graceful shutdown
+	quit    chan struct{}  // stop signal
+	running atomic.Bool    // accepting connections
+	stop    sync.Once
 }
 
 func NewServer(cfg ListenerConfig, p *proxy.Proxy) *Server {
-	return &Server{
+	s := &Server{
 		cfg:   cfg,
 		proxy: p,
-		sem:   make(chan struct{}, cfg.MaxConnections),
+		conns: make(map[net.Conn]struct{}),
 		quit:  make(chan struct{}),
 	}
+	s.slots = sync.NewCond(&s.mu)
+	return s
+}
+
+// SetConfig changes the connection limit and timeouts of a running server.
+// Lowering MaxConnections does not close connections, it only holds new
+// ones until enough have ended. The address cannot be changed.
+func (s *Server) SetConfig(cfg ListenerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg.Address = s.cfg.Address
+	s.cfg = cfg
+	s.slots.Broadcast()
+}
+
+func (s *Server) config() ListenerConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
 }
 
 func (s *Server) Start() error {
-	var err error
-	s.listener, err = net.Listen("tcp", s.cfg.Address)
+	ln, err := net.Listen("tcp", s.config().Address)
 	if err != nil {
 		return err
 	}
+	s.mu.Lock()
+	s.listener = ln
+	stopping := s.stopping
+	s.mu.Unlock()
+	if stopping {
+		ln.Close()
+		return nil
+	}
 
-	log.Printf("Listener started on %s", s.cfg.Address)
+	s.running.Store(true)
+	defer s.running.Store(false)
+	slog.Info("listener started", "address", ln.Addr().String())
 
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := ln.Accept()
 		if err != nil {
 			select {
 			case <-s.quit:
 				return nil
 			default:
-				log.Printf("accept error: %v", err)
+				slog.Error("accept error", "err", err)
 				continue
 			}
 		}
 
-		s.sem <- struct{}{}
+		if !s.acquire(conn) {
+			_ = conn.Close()
+			return nil
+		}
 		s.wg.Add(1)
 
 		go s.handleConnection(conn)
 	}
 }
 
+// acquire waits for a connection slot under MaxConnections and registers
+// conn. It returns false once the server is stopping.
+func (s *Server) acquire(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.conns) >= s.cfg.MaxConnections && !s.stopping {
+		s.slots.Wait()
+	}
+	if s.stopping {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) release(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	s.slots.Signal()
+}
+
+// Running reports whether the server is accepting client connections.
+func (s *Server) Running() bool {
+	return s.running.Load()
+}
+
+// Stop stops accepting connections and closes the open ones right away.
 func (s *Server) Stop() {
-	close(s.quit)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = s.Shutdown(ctx)
+}
 
-	if s.listener != nil {
-		_ = s.listener.Close()
+// Shutdown stops accepting connections, then ends client sessions
+// gracefully with proxy.Shutdown. Connections left when the sessions have
+// ended or ctx is done, such as admin console ones, are closed, and Shutdown
+// waits for their handlers so that no backend connection is in use once it
+// returns. It returns the error of proxy.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.running.Store(false)
+	s.stop.Do(func() {
+		close(s.quit)
+		s.mu.Lock()
+		s.stopping = true
+		s.slots.Broadcast()
+		if s.listener != nil {
+			_ = s.listener.Close()
+		}
+		s.mu.Unlock()
+	})
+
+	err := s.proxy.Shutdown(ctx)
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
 	}
+	s.mu.Unlock()
 
+	// killed sessions have their backend connections closed too, so no
+	// handler stays blocked on a backend
 	s.wg.Wait()
-	log.Println("Listener stopped")
+	slog.Info("listener stopped")
+	return err
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
-	metrics.IncActiveConnections()
+	activeConnections.Inc()
 	defer s.wg.Done()
 	defer func() {
-		metrics.DecActiveConnections()
-		<-s.sem
+		activeConnections.Dec()
+		s.release(conn)
 		_ = conn.Close()
 	}()
 
-	_ = conn.SetReadDeadline(time.Now().Add(s.cfg.ReadTimeout))
-	_ = conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+	cfg := s.config()
+	_ = conn.SetReadDeadline(time.Now().Add(cfg.ReadTimeout))
+	_ = conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
 
-	log.Printf("Accepted connection from %s", conn.RemoteAddr())
+	slog.Debug("accepted connection", "client_addr", conn.RemoteAddr().String())
 
 	s.proxy.HandleClient(conn)
 }
@@ -0,0 +1,287 @@
+package listener
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/proxy"
+	"github.com/user/pggate/internal/router"
+)
+
+func startServer(t *testing.T, primary string, maxConns int) (*Server, *proxy.Proxy, *pool.PoolManager) {
+	t.Helper()
+	pm := pool.NewPoolManager(primary, nil, 4, 4, time.Minute)
+	t.Cleanup(pm.Close)
+	p := proxy.NewProxy(proxy.ProxyConfig{}, pm, router.NewRouter())
+	s := NewServer(ListenerConfig{Address: "127.0.0.1:0", MaxConnections: maxConns, ReadTimeout: time.Minute, WriteTimeout: time.Minute}, p)
+	go s.Start()
+	t.Cleanup(s.Stop)
+	for deadline := time.Now().Add(time.Second); !s.Running(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("listener did not start")
+		}
+	}
+	return s, p, pm
+}
+
+func (s *Server) addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listener.Addr().String()
+}
+
+func (s *Server) open() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+func dial(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// served sends an SSLRequest and reports whether the proxy declined it
+// within d, which it only does once the connection got a slot.
+func served(t *testing.T, conn net.Conn, d time.Duration) bool {
+	t.Helper()
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], proxy.SSLRequestCode)
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	return answered(t, conn, d)
+}
+
+func answered(t *testing.T, conn net.Conn, d time.Duration) bool {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(d))
+	defer conn.SetReadDeadline(time.Time{})
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return false
+	}
+	if err != nil || b[0] != 'N' {
+		t.Fatalf("SSLRequest answered %q, %v, want N", b[0], err)
+	}
+	return true
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestServer_SetConfigLowersLimit(t *testing.T) {
+	s, _, _ := startServer(t, "127.0.0.1:1", 2)
+	a, b := dial(t, s), dial(t, s)
+	if !served(t, a, time.Second) || !served(t, b, time.Second) {
+		t.Fatal("connections under the limit not served")
+	}
+
+	s.SetConfig(ListenerConfig{MaxConnections: 1, ReadTimeout: time.Minute, WriteTimeout: time.Minute})
+	if got := s.config().Address; got != "127.0.0.1:0" {
+		t.Errorf("SetConfig() changed the address to %q", got)
+	}
+	a.Close()
+	waitFor(t, "the closed connection to be released", func() bool { return s.open() == 1 })
+
+	// one connection is still open, which is the new limit
+	c := dial(t, s)
+	if served(t, c, 100*time.Millisecond) {
+		t.Fatal("connection over the lowered limit was served")
+	}
+	b.Close()
+	if !answered(t, c, time.Second) {
+		t.Error("held connection not served once under the lowered limit")
+	}
+}
+
+// startBackend runs a Postgres stand-in that accepts any startup and answers
+// simple queries with CommandComplete and ReadyForQuery, except queries
+// calling pg_sleep, which it never answers. closed receives when the proxy
+// closes a connection.
+func startBackend(t *testing.T) (addr string, closed chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closed = make(chan struct{}, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveBackend(conn, closed)
+		}
+	}()
+	return ln.Addr().String(), closed
+}
+
+func serveBackend(conn net.Conn, closed chan struct{}) {
+	defer conn.Close()
+	var n [4]byte
+	if _, err := io.ReadFull(conn, n[:]); err != nil {
+		return
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(binary.BigEndian.Uint32(n[:])-4)); err != nil {
+		return
+	}
+	// AuthenticationOk, ReadyForQuery
+	conn.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0, 'Z', 0, 0, 0, 5, 'I'})
+	for {
+		typ, body, err := readMessage(conn)
+		if err != nil {
+			closed <- struct{}{}
+			return
+		}
+		query := strings.TrimRight(string(body), "\x00")
+		if typ != config.QueryMessage || strings.Contains(query, "pg_sleep") {
+			continue
+		}
+		tag, _, _ := strings.Cut(query, " ")
+		status := byte('I')
+		if strings.EqualFold(tag, "BEGIN") {
+			status = 'T'
+		}
+		conn.Write(message(config.CommandComplete, strings.ToUpper(tag)+"\x00"))
+		conn.Write([]byte{config.ReadyForQuery, 0, 0, 0, 5, status})
+	}
+}
+
+func message(typ byte, body string) []byte {
+	msg := []byte{typ, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msg[1:], uint32(4+len(body)))
+	return append(msg, body...)
+}
+
+func readMessage(conn net.Conn) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(hdr[1:])-4)
+	_, err := io.ReadFull(conn, body)
+	return hdr[0], body, err
+}
+
+// connect starts a session as user and waits for ReadyForQuery.
+func connect(t *testing.T, s *Server, user string) net.Conn {
+	t.Helper()
+	conn := dial(t, s)
+	body := []byte{0, 3, 0, 0}
+	body = append(append(append(body, "user\x00"...), user...), 0, 0)
+	startup := make([]byte, 4, 4+len(body))
+	binary.BigEndian.PutUint32(startup, uint32(4+len(body)))
+	if _, err := conn.Write(append(startup, body...)); err != nil {
+		t.Fatal(err)
+	}
+	readUntilReady(t, conn)
+	return conn
+}
+
+func readUntilReady(t *testing.T, conn net.Conn) {
+	t.Helper()
+	for {
+		typ, body, err := readMessage(conn)
+		if err != nil {
+			t.Fatalf("reading message: %v", err)
+		}
+		if typ == config.ErrorResponse {
+			t.Fatalf("ErrorResponse %q", body)
+		}
+		if typ == config.ReadyForQuery {
+			return
+		}
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	backend, closed := startBackend(t)
+	s, p, pm := startServer(t, backend, 10)
+	idle := connect(t, s, "idle")
+	inTx := connect(t, s, "tx")
+	if _, err := inTx.Write(message(config.QueryMessage, "BEGIN\x00")); err != nil {
+		t.Fatal(err)
+	}
+	readUntilReady(t, inTx)
+	// the backend never answers, so the session waits on it
+	if _, err := inTx.Write(message(config.QueryMessage, "SELECT pg_sleep(60)\x00")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the query to reach the backend", func() bool {
+		for _, si := range p.Sessions() {
+			if si.User == "tx" {
+				return si.State == proxy.StateActive
+			}
+		}
+		return false
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(ctx) }()
+
+	// the idle client is told right away
+	typ, body, err := readMessage(idle)
+	if err != nil || typ != config.ErrorResponse || !strings.Contains(string(body), "C57P01\x00") {
+		t.Errorf("idle client got %c %q, %v, want ErrorResponse 57P01", typ, body, err)
+	}
+	if _, _, err := readMessage(idle); err != io.EOF {
+		t.Errorf("idle client read after the shutdown error = %v, want EOF", err)
+	}
+
+	// the session waiting on the backend is killed when the timeout expires,
+	// with its backend connection, and Shutdown waits for it
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown() did not return after its timeout")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("backend connection of the killed session not closed")
+	}
+	if _, _, err := readMessage(inTx); err == nil {
+		t.Error("client in a transaction still open after Shutdown()")
+	}
+	if n := s.open(); n != 0 {
+		t.Errorf("%d connections open after Shutdown()", n)
+	}
+	if n := len(p.Sessions()); n != 0 {
+		t.Errorf("%d sessions left after Shutdown()", n)
+	}
+	if n := pm.RWPool.InUse(); n != 0 {
+		t.Errorf("%d primary connections in use after Shutdown(), want 0 before the pools close", n)
+	}
+	if s.Running() {
+		t.Error("Running() = true after Shutdown()")
+	}
+}
@@ -0,0 +1,81 @@
+// Package logging configures the process-wide slog logger.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type Config struct {
+	Level  string    // debug, info (default), warn or error
+	Format string    // text (default) or json
+	Output io.Writer // defaults to stderr
+}
+
+// level is the level of the logger installed by Setup, changed by SetLevel.
+var level slog.LevelVar
+
+// New returns a logger for cfg.
+func New(cfg Config) (*slog.Logger, error) {
+	l, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	return newLogger(cfg, l)
+}
+
+func newLogger(cfg Config, level slog.Leveler) (*slog.Logger, error) {
+	out := cfg.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(out, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+}
+
+// Setup installs the logger for cfg as the slog default, which also routes
+// the standard log package through it.
+func Setup(cfg Config) error {
+	if err := SetLevel(cfg.Level); err != nil {
+		return err
+	}
+	l, err := newLogger(cfg, &level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(l)
+	return nil
+}
+
+// SetLevel changes the level of the logger installed by Setup.
+func SetLevel(s string) error {
+	l, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
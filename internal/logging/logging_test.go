@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"", slog.LevelInfo, false},
+		{"debug", slog.LevelDebug, false},
+		{"WARN", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(Config{Level: "warn", Format: "json", Output: &buf})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	l.Info("dropped")
+	l.Warn("kept", "backend", "replica1:5432")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("New() logged %d lines, want 1:\n%s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("json format wrote %q: %v", lines[0], err)
+	}
+	if rec["msg"] != "kept" || rec["backend"] != "replica1:5432" {
+		t.Errorf("record = %v", rec)
+	}
+
+	if _, err := New(Config{Format: "xml"}); err == nil {
+		t.Errorf("New() with unknown format: expected error")
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	if err := Setup(Config{Level: "info"}); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	defer Setup(Config{})
+	if err := SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel() error = %v", err)
+	}
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("SetLevel(debug) did not enable debug records")
+	}
+	if err := SetLevel("verbose"); err == nil {
+		t.Errorf("SetLevel() with unknown level: expected error")
+	}
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("SetLevel() with unknown level changed the level")
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ContentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	ContentTypeJSON        = "application/json"
+)
+
+// WriteText writes families in the Prometheus text exposition format 0.0.4.
+func WriteText(w io.Writer, families []Family) error {
+	return writeText(w, families, false)
+}
+
+// WriteOpenMetrics writes families in the OpenMetrics 1.0 text format.
+func WriteOpenMetrics(w io.Writer, families []Family) error {
+	return writeText(w, families, true)
+}
+
+func writeText(w io.Writer, families []Family, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		name := f.Name
+		if openMetrics && f.Type == CounterType {
+			// OpenMetrics names the counter family without the sample suffix
+			name = strings.TrimSuffix(name, "_total")
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(f.Help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.Type)
+		for _, s := range f.Series {
+			if f.Type == HistogramType && s.Histogram != nil {
+				writeHistogram(bw, f.Name, s)
+				continue
+			}
+			sample := f.Name
+			if openMetrics && f.Type == CounterType && !strings.HasSuffix(sample, "_total") {
+				sample += "_total"
+			}
+			fmt.Fprintf(bw, "%s%s %s\n", sample, formatLabels(s.Labels), formatValue(s.Value))
+		}
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+func writeHistogram(w io.Writer, name string, s Series) {
+	h := s.Histogram
+	for _, b := range h.Buckets {
+		le := Label{Name: "le", Value: formatValue(b.UpperBound)}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(append(s.Labels[:len(s.Labels):len(s.Labels)], le)), b.Count)
+	}
+	inf := Label{Name: "le", Value: "+Inf"}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(append(s.Labels[:len(s.Labels):len(s.Labels)], inf)), h.Count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(s.Labels), formatValue(h.Sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(s.Labels), h.Count)
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, l.Name, EscapeLabel(l.Value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// EscapeLabel escapes a value for use inside a quoted Prometheus label.
+func EscapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeHelp(v string) string {
+	return helpEscaper.Replace(v)
+}
+
+// Handler serves the registry, negotiating the format from the Accept header.
+// ?format=json (or Accept: application/json) returns the families as JSON.
+func Handler(reg *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families := reg.Gather()
+		var err error
+		switch negotiate(r) {
+		case ContentTypeJSON:
+			w.Header().Set("Content-Type", ContentTypeJSON)
+			err = json.NewEncoder(w).Encode(families)
+		case ContentTypeOpenMetrics:
+			w.Header().Set("Content-Type", ContentTypeOpenMetrics)
+			err = WriteOpenMetrics(w, families)
+		default:
+			w.Header().Set("Content-Type", ContentTypeText)
+			err = WriteText(w, families)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func negotiate(r *http.Request) string {
+	if r.URL.Query().Get("format") == "json" {
+		return ContentTypeJSON
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case "application/openmetrics-text":
+			return ContentTypeOpenMetrics
+		case "application/json":
+			return ContentTypeJSON
+		}
+	}
+	return ContentTypeText
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are upper bounds in seconds suited to connection and
+// query latencies.
+var DefaultLatencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram is a lock-free cumulative histogram in the Prometheus sense.
+type Histogram struct {
+	bounds  []float64
+	counts  []atomic.Uint64 // per bucket, non-cumulative; last is +Inf
+	count   atomic.Uint64
+	sumBits atomic.Uint64 // float64 sum of observations
+}
+
+// NewHistogram returns an unregistered histogram, for collectors that export
+// it themselves through Snapshot.
+func NewHistogram(bounds []float64) *Histogram {
+	h := &Histogram{}
+	h.init(bounds)
+	return h
+}
+
+func (h *Histogram) init(bounds []float64) {
+	h.bounds = bounds
+	h.counts = make([]atomic.Uint64, len(bounds)+1)
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	addFloat(&h.sumBits, v)
+}
+
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the sum of all observations.
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sumBits.Load())
+}
+
+// Bucket is a cumulative histogram bucket. The +Inf bucket is implied by
+// HistogramSnapshot.Count.
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+type HistogramSnapshot struct {
+	Buckets []Bucket `json:"buckets"`
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+}
+
+// Snapshot returns the cumulative bucket counts. Concurrent observations may
+// land between bucket reads; Count is derived from the buckets so the
+// snapshot is always self-consistent.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{Buckets: make([]Bucket, len(h.bounds)), Sum: h.Sum()}
+	var cumulative uint64
+	for i, b := range h.bounds {
+		cumulative += h.counts[i].Load()
+		s.Buckets[i] = Bucket{UpperBound: b, Count: cumulative}
+	}
+	s.Count = cumulative + h.counts[len(h.bounds)].Load()
+	return s
+}
+
+// HistogramVec is a set of histograms sharing bucket bounds, one per
+// combination of label values.
+type HistogramVec struct {
+	*vec[Histogram]
+}
+
+// With returns the histogram for the given label values, in the order the
+// labels were declared.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values)
+}
+
+// Quantile estimates the q-quantile (0 <= q <= 1) by linear interpolation
+// within the bucket it falls into. Observations above the highest bound are
+// reported as that bound.
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := q * float64(s.Count)
+	var lower float64
+	var below uint64
+	for _, b := range s.Buckets {
+		if float64(b.Count) >= rank && b.Count > below {
+			return lower + (b.UpperBound-lower)*(rank-float64(below))/float64(b.Count-below)
+		}
+		lower, below = b.UpperBound, b.Count
+	}
+	return lower
+}
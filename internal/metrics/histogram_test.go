@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	if h.Count() != 3 {
+		t.Errorf("Count() = %d, want 3", h.Count())
+	}
+	if h.Sum() != 5.55 {
+		t.Errorf("Sum() = %v, want 5.55", h.Sum())
+	}
+
+	snap := h.Snapshot()
+	want := []Bucket{{0.1, 1}, {1, 2}}
+	if len(snap.Buckets) != len(want) || snap.Buckets[0] != want[0] || snap.Buckets[1] != want[1] {
+		t.Errorf("Snapshot().Buckets = %v, want %v", snap.Buckets, want)
+	}
+	if snap.Count != 3 || snap.Sum != 5.55 {
+		t.Errorf("Snapshot() count/sum = %d/%v, want 3/5.55", snap.Count, snap.Sum)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	reg := NewRegistry()
+	v := reg.NewHistogramVec("query_seconds", "Query latency", []float64{1}, "destination", "statement")
+	v.With("replica", "select").Observe(0.5)
+	v.With("replica", "select").Observe(2)
+	v.With("primary", `in"sert`).Observe(0.5)
+
+	if v.With("replica", "select").Count() != 2 {
+		t.Errorf("With() did not return the same histogram for equal label values")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, reg.Gather()); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE query_seconds histogram",
+		`query_seconds_count{destination="replica",statement="select"} 2`,
+		`query_seconds_bucket{destination="replica",statement="select",le="+Inf"} 2`,
+		`query_seconds_bucket{destination="primary",statement="in\"sert",le="1"} 1`,
+		`query_seconds_sum{destination="primary",statement="in\"sert"} 0.5`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("WriteText() missing %q in:\n%s", line, out)
+		}
+	}
+	// series are sorted for stable output
+	if strings.Index(out, `destination="primary"`) > strings.Index(out, `destination="replica"`) {
+		t.Errorf("WriteText() series not sorted:\n%s", out)
+	}
+}
+
+func TestHistogramSnapshot_Quantile(t *testing.T) {
+	h := NewHistogram([]float64{1, 2, 4})
+	for _, v := range []float64{0.5, 1.5, 1.5, 3} {
+		h.Observe(v)
+	}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 0},
+		{0.25, 1},
+		{0.5, 1.5},
+		{0.75, 2},
+		{1, 4},
+	}
+	snap := h.Snapshot()
+	for _, tt := range tests {
+		if got := snap.Quantile(tt.q); got != tt.want {
+			t.Errorf("Quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	h.Observe(100)
+	if got := h.Snapshot().Quantile(1); got != 4 {
+		t.Errorf("Quantile(1) above the highest bound = %v, want 4", got)
+	}
+	if got := NewHistogram([]float64{1}).Snapshot().Quantile(0.5); got != 0 {
+		t.Errorf("Quantile() of empty histogram = %v, want 0", got)
+	}
+}
@@ -2,72 +2,164 @@ package metrics
 
 import (
 	"fmt"
-	"net/http"
+	"math"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
 
-type Metrics struct {
-	ActiveClientConnections  int64
-	TotalQueries             int64
-	PrimaryQueries           int64
-	ReplicaQueries           int64
-	Errors                   int64
-	BackendRWConnectionsOpen int64
-	BackendROConnectionsOpen int64
+// Counter is a monotonically increasing value.
+type Counter struct {
+	bits atomic.Uint64
 }
 
-var (
-	GlobalMetrics = &Metrics{}
-	mu            sync.Mutex
-)
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter; negative values are ignored.
+func (c *Counter) Add(v float64) {
+	if v > 0 {
+		addFloat(&c.bits, v)
+	}
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
 
-func IncActiveConnections() {
-	atomic.AddInt64(&GlobalMetrics.ActiveClientConnections, 1)
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
 }
 
-func DecActiveConnections() {
-	atomic.AddInt64(&GlobalMetrics.ActiveClientConnections, -1)
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
 }
 
-func IncTotalQueries() {
-	atomic.AddInt64(&GlobalMetrics.TotalQueries, 1)
+func (g *Gauge) Inc() {
+	g.Add(1)
 }
 
-func IncPrimaryQueries() {
-	atomic.AddInt64(&GlobalMetrics.PrimaryQueries, 1)
+func (g *Gauge) Dec() {
+	g.Add(-1)
 }
 
-func IncReplicaQueries() {
-	atomic.AddInt64(&GlobalMetrics.ReplicaQueries, 1)
+func (g *Gauge) Add(v float64) {
+	addFloat(&g.bits, v)
 }
 
-func IncErrors() {
-	atomic.AddInt64(&GlobalMetrics.Errors, 1)
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
 }
 
-func ServeMetrics(addr string) error {
-	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "# HELP pggate_active_client_connections Current number of active client connections\n")
-		fmt.Fprintf(w, "# TYPE pggate_active_client_connections gauge\n")
-		fmt.Fprintf(w, "pggate_active_client_connections %d\n", atomic.LoadInt64(&GlobalMetrics.ActiveClientConnections))
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// CounterVec is a set of counters, one per combination of label values.
+type CounterVec struct {
+	*vec[Counter]
+}
 
-		fmt.Fprintf(w, "# HELP pggate_total_queries_total Total number of queries handled\n")
-		fmt.Fprintf(w, "# TYPE pggate_total_queries_total counter\n")
-		fmt.Fprintf(w, "pggate_total_queries_total %d\n", atomic.LoadInt64(&GlobalMetrics.TotalQueries))
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values)
+}
 
-		fmt.Fprintf(w, "# HELP pggate_primary_queries_total Total number of queries routed to primary\n")
-		fmt.Fprintf(w, "# TYPE pggate_primary_queries_total counter\n")
-		fmt.Fprintf(w, "pggate_primary_queries_total %d\n", atomic.LoadInt64(&GlobalMetrics.PrimaryQueries))
+// GaugeVec is a set of gauges, one per combination of label values.
+type GaugeVec struct {
+	*vec[Gauge]
+}
 
-		fmt.Fprintf(w, "# HELP pggate_replica_queries_total Total number of queries routed to replicas\n")
-		fmt.Fprintf(w, "# TYPE pggate_replica_queries_total counter\n")
-		fmt.Fprintf(w, "pggate_replica_queries_total %d\n", atomic.LoadInt64(&GlobalMetrics.ReplicaQueries))
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.with(values)
+}
 
-		fmt.Fprintf(w, "# HELP pggate_errors_total Total number of errors encountered\n")
-		fmt.Fprintf(w, "# TYPE pggate_errors_total counter\n")
-		fmt.Fprintf(w, "pggate_errors_total %d\n", atomic.LoadInt64(&GlobalMetrics.Errors))
-	})
+// vec maps label values to metrics of type T.
+type vec[T any] struct {
+	labels  []string
+	init    func(*T)
+	mu      sync.RWMutex
+	metrics map[string]*T
+	values  map[string][]string
+}
+
+func newVec[T any](labels []string) *vec[T] {
+	return &vec[T]{
+		labels:  labels,
+		metrics: make(map[string]*T),
+		values:  make(map[string][]string),
+	}
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for labels %v", len(values), v.labels))
+	}
+	key := strings.Join(values, "\x00")
+	v.mu.RLock()
+	m, ok := v.metrics[key]
+	v.mu.RUnlock()
+	if ok {
+		return m
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if m, ok := v.metrics[key]; ok {
+		return m
+	}
+	m = new(T)
+	if v.init != nil {
+		v.init(m)
+	}
+	v.metrics[key] = m
+	v.values[key] = slices.Clone(values)
+	return m
+}
+
+// Delete drops the series for the given label values, e.g. when a backend is
+// removed.
+func (v *vec[T]) Delete(values ...string) {
+	key := strings.Join(values, "\x00")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.metrics, key)
+	delete(v.values, key)
+}
+
+// each calls fn for every series, sorted by label values for stable output.
+func (v *vec[T]) each(fn func([]Label, *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.metrics))
+	for k := range v.metrics {
+		keys = append(keys, k)
+	}
+	v.mu.RUnlock()
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		v.mu.RLock()
+		m, values := v.metrics[k], v.values[k]
+		v.mu.RUnlock()
+		if m == nil {
+			continue
+		}
+		fn(Labels(v.labels, values), m)
+	}
+}
 
-	return http.ListenAndServe(addr, nil)
+// Labels pairs label names with values.
+func Labels(names, values []string) []Label {
+	out := make([]Label, len(names))
+	for i, n := range names {
+		out[i] = Label{Name: n, Value: values[i]}
+	}
+	return out
 }
@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type Type string
+
+const (
+	CounterType   Type = "counter"
+	GaugeType     Type = "gauge"
+	HistogramType Type = "histogram"
+)
+
+type Label struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Series is one labelled time series of a family. Value is used by counters
+// and gauges, Histogram by histograms.
+type Series struct {
+	Labels    []Label            `json:"labels,omitempty"`
+	Value     float64            `json:"value"`
+	Histogram *HistogramSnapshot `json:"histogram,omitempty"`
+}
+
+// Family is a named metric with all of its series, as gathered for one scrape.
+type Family struct {
+	Name   string   `json:"name"`
+	Help   string   `json:"help"`
+	Type   Type     `json:"type"`
+	Series []Series `json:"series"`
+}
+
+// Collector produces metric families on every scrape. Counters, gauges and
+// histograms created through a Registry are collectors; packages with state
+// of their own, like connection pools, implement it to export snapshots.
+type Collector interface {
+	Collect() []Family
+}
+
+// CollectorFunc adapts a function to the Collector interface.
+type CollectorFunc func() []Family
+
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+// Registry holds the collectors exposed by a metrics endpoint.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// Default is the registry served by the metrics server and used by the
+// package-level constructors.
+var Default = NewRegistry()
+
+// Register adds a collector. It is called by the metric constructors; use it
+// directly for custom collectors.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// claim reserves a metric name, panicking on duplicates like a second
+// registration of the same metric would be a programming error.
+func (r *Registry) claim(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.names[name] = true
+}
+
+// Gather collects every family, merging families of the same name and
+// sorting them by name.
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	cs := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	byName := make(map[string]int)
+	var out []Family
+	for _, c := range cs {
+		for _, f := range c.Collect() {
+			if i, ok := byName[f.Name]; ok {
+				out[i].Series = append(out[i].Series, f.Series...)
+				continue
+			}
+			byName[f.Name] = len(out)
+			out = append(out, f)
+		}
+	}
+	slices.SortFunc(out, func(a, b Family) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	r.claim(name)
+	c := &Counter{}
+	r.Register(CollectorFunc(func() []Family {
+		return []Family{{Name: name, Help: help, Type: CounterType, Series: []Series{{Value: c.Value()}}}}
+	}))
+	return c
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	r.claim(name)
+	v := &CounterVec{vec: newVec[Counter](labels)}
+	r.Register(CollectorFunc(func() []Family {
+		f := Family{Name: name, Help: help, Type: CounterType}
+		v.each(func(ls []Label, c *Counter) {
+			f.Series = append(f.Series, Series{Labels: ls, Value: c.Value()})
+		})
+		return []Family{f}
+	}))
+	return v
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	r.claim(name)
+	g := &Gauge{}
+	r.Register(CollectorFunc(func() []Family {
+		return []Family{{Name: name, Help: help, Type: GaugeType, Series: []Series{{Value: g.Value()}}}}
+	}))
+	return g
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	r.claim(name)
+	v := &GaugeVec{vec: newVec[Gauge](labels)}
+	r.Register(CollectorFunc(func() []Family {
+		f := Family{Name: name, Help: help, Type: GaugeType}
+		v.each(func(ls []Label, g *Gauge) {
+			f.Series = append(f.Series, Series{Labels: ls, Value: g.Value()})
+		})
+		return []Family{f}
+	}))
+	return v
+}
+
+func (r *Registry) NewHistogram(name, help string, bounds []float64) *Histogram {
+	r.claim(name)
+	h := NewHistogram(bounds)
+	r.Register(CollectorFunc(func() []Family {
+		snap := h.Snapshot()
+		return []Family{{Name: name, Help: help, Type: HistogramType, Series: []Series{{Histogram: &snap}}}}
+	}))
+	return h
+}
+
+func (r *Registry) NewHistogramVec(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	r.claim(name)
+	v := &HistogramVec{vec: newVec[Histogram](labels)}
+	v.vec.init = func(h *Histogram) { h.init(bounds) }
+	r.Register(CollectorFunc(func() []Family {
+		f := Family{Name: name, Help: help, Type: HistogramType}
+		v.each(func(ls []Label, h *Histogram) {
+			snap := h.Snapshot()
+			f.Series = append(f.Series, Series{Labels: ls, Histogram: &snap})
+		})
+		return []Family{f}
+	}))
+	return v
+}
+
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+func NewHistogramVec(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, bounds, labels...)
+}
+
+// Register adds a custom collector to the Default registry.
+func Register(c Collector) {
+	Default.Register(c)
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Gather(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("b_requests_total", "Requests")
+	g := reg.NewGaugeVec("a_connections", "Connections", "state")
+	c.Inc()
+	c.Add(2)
+	c.Add(-1) // ignored
+	g.With("idle").Set(3)
+	g.With("busy").Inc()
+	g.With("busy").Dec()
+	reg.Register(CollectorFunc(func() []Family {
+		return []Family{{Name: "a_connections", Type: GaugeType, Series: []Series{{Labels: []Label{{"state", "dialing"}}, Value: 1}}}}
+	}))
+
+	fs := reg.Gather()
+	if len(fs) != 2 || fs[0].Name != "a_connections" || fs[1].Name != "b_requests_total" {
+		t.Fatalf("Gather() = %+v, want a_connections then b_requests_total", fs)
+	}
+	if got := len(fs[0].Series); got != 3 {
+		t.Errorf("len(a_connections series) = %d, want 3 (collector families merged)", got)
+	}
+	if fs[1].Series[0].Value != 3 {
+		t.Errorf("counter value = %v, want 3", fs[1].Series[0].Value)
+	}
+}
+
+func TestRegistry_DuplicateName(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("x_total", "")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering x_total twice did not panic")
+		}
+	}()
+	reg.NewGauge("x_total", "")
+}
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterVec("queries_total", "Queries\nhandled", "user").With(`a\b`).Add(1.5)
+	reg.NewGauge("up", "Up").Set(1)
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, reg.Gather()); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	want := "# HELP queries_total Queries\\nhandled\n" +
+		"# TYPE queries_total counter\n" +
+		"queries_total{user=\"a\\\\b\"} 1.5\n" +
+		"# HELP up Up\n" +
+		"# TYPE up gauge\n" +
+		"up 1\n"
+	if buf.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteOpenMetrics(&buf, reg.Gather()); err != nil {
+		t.Fatalf("WriteOpenMetrics() error = %v", err)
+	}
+	out := buf.String()
+	for _, line := range []string{"# TYPE queries counter\n", `queries_total{user="a\\b"} 1.5` + "\n"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("WriteOpenMetrics() missing %q in:\n%s", line, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("WriteOpenMetrics() does not end with # EOF:\n%s", out)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewGauge("up", "Up").Set(1)
+	h := Handler(reg)
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		contentType string
+	}{
+		{"default", "/metrics", "", ContentTypeText},
+		{"prometheus", "/metrics", "text/plain;version=0.0.4;q=0.5,*/*;q=0.1", ContentTypeText},
+		{"openmetrics", "/metrics", "application/openmetrics-text;version=1.0.0,text/plain;q=0.5", ContentTypeOpenMetrics},
+		{"json accept", "/metrics", "application/json", ContentTypeJSON},
+		{"json query", "/metrics?format=json", "", ContentTypeJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if tt.contentType == ContentTypeJSON {
+				var fs []Family
+				if err := json.Unmarshal(rec.Body.Bytes(), &fs); err != nil || len(fs) != 1 || fs[0].Series[0].Value != 1 {
+					t.Errorf("JSON body = %s (err %v)", rec.Body.String(), err)
+				}
+			}
+		})
+	}
+}
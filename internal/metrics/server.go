@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Server is the HTTP server exposing /metrics. It has its own mux so other
+// handlers, like the admin API, can be mounted next to it with Handle.
+type Server struct {
+	mux *http.ServeMux
+	srv *http.Server
+}
+
+func NewServer(addr string, reg *Registry) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler(reg))
+	return &Server{
+		mux: mux,
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) Addr() string {
+	return s.srv.Addr
+}
+
+// ListenAndServe blocks until the server fails or is shut down, in which
+// case it returns nil.
+func (s *Server) ListenAndServe() error {
+	if err := s.srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,179 @@
+package pool
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+const (
+	BalanceRoundRobin     = "round_robin"
+	BalanceLeastConn      = "least_conn"
+	BalancePowerOfTwo     = "p2c"
+	BalanceConsistentHash = "consistent_hash"
+)
+
+// Balancer picks one pool out of a replica group. key identifies the client
+// and is only used by strategies that care about locality. Pick is called
+// with the PoolManager lock held and pools is never empty.
+type Balancer interface {
+	Pick(pools []*Pool, key string) *Pool
+}
+
+// NewBalancer returns a fresh balancer for the named strategy. An empty name
+// selects weighted round-robin.
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", BalanceRoundRobin:
+		return &weightedRoundRobin{}, nil
+	case BalanceLeastConn:
+		return leastConn{}, nil
+	case BalancePowerOfTwo:
+		return powerOfTwo{}, nil
+	case BalanceConsistentHash:
+		return &consistentHash{fallback: &weightedRoundRobin{}}, nil
+	}
+	return nil, fmt.Errorf("unknown balancer %q", name)
+}
+
+// weightedRoundRobin is the smooth weighted round-robin used by nginx: every
+// pick adds each weight to its running score and takes the highest.
+type weightedRoundRobin struct {
+	current map[*Pool]int
+}
+
+func (b *weightedRoundRobin) Pick(pools []*Pool, _ string) *Pool {
+	if b.current == nil {
+		b.current = make(map[*Pool]int)
+	}
+	var best *Pool
+	total := 0
+	for _, p := range pools {
+		w := p.Weight()
+		total += w
+		b.current[p] += w
+		if best == nil || b.current[p] > b.current[best] {
+			best = p
+		}
+	}
+	b.current[best] -= total
+	if len(b.current) > len(pools) {
+		// forget pools removed from the group or out of rotation
+		for p := range b.current {
+			if !slices.Contains(pools, p) {
+				delete(b.current, p)
+			}
+		}
+	}
+	return best
+}
+
+// leastConn picks the pool with the fewest connections handed out relative
+// to its weight.
+type leastConn struct{}
+
+func (leastConn) Pick(pools []*Pool, _ string) *Pool {
+	best := pools[0]
+	for _, p := range pools[1:] {
+		// compare inUse/weight without dividing
+		if p.InUse()*int64(best.Weight()) < best.InUse()*int64(p.Weight()) {
+			best = p
+		}
+	}
+	return best
+}
+
+// powerOfTwo samples two pools at random and keeps the one with the lower
+// observed latency, penalised by its error rate, falling back to outstanding
+// connections when either has not been measured yet.
+type powerOfTwo struct{}
+
+func (powerOfTwo) Pick(pools []*Pool, _ string) *Pool {
+	if len(pools) == 1 {
+		return pools[0]
+	}
+	i := rand.IntN(len(pools))
+	j := rand.IntN(len(pools) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := pools[i], pools[j]
+	sa, sb := a.score(), b.score()
+	if sa == 0 || sb == 0 {
+		return leastConn{}.Pick([]*Pool{a, b}, "")
+	}
+	if sb < sa {
+		return b
+	}
+	return a
+}
+
+const hashReplicas = 100 // virtual nodes per unit of weight
+
+// consistentHash maps client keys onto a hash ring so the same client keeps
+// landing on the same replica while the group and its weights are unchanged.
+type consistentHash struct {
+	pools    []*Pool
+	weights  []int // of pools when the ring was built
+	ring     []uint32
+	owners   map[uint32]*Pool
+	fallback Balancer
+}
+
+func (b *consistentHash) Pick(pools []*Pool, key string) *Pool {
+	if key == "" {
+		return b.fallback.Pick(pools, key)
+	}
+	if !b.built(pools) {
+		b.build(pools)
+	}
+	h := hashKey(key)
+	i := sort.Search(len(b.ring), func(i int) bool { return b.ring[i] >= h })
+	if i == len(b.ring) {
+		i = 0
+	}
+	return b.owners[b.ring[i]]
+}
+
+func (b *consistentHash) build(pools []*Pool) {
+	b.pools = append([]*Pool(nil), pools...)
+	b.weights = b.weights[:0]
+	b.ring = b.ring[:0]
+	b.owners = make(map[uint32]*Pool)
+	for _, p := range pools {
+		w := p.Weight()
+		b.weights = append(b.weights, w)
+		for v := 0; v < hashReplicas*w; v++ {
+			h := hashKey(p.Address() + "#" + strconv.Itoa(v))
+			if _, taken := b.owners[h]; taken {
+				continue
+			}
+			b.owners[h] = p
+			b.ring = append(b.ring, h)
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i] < b.ring[j] })
+}
+
+// built reports whether the ring was built for pools with their current
+// weights, which SetGroup may change on reload.
+func (b *consistentHash) built(pools []*Pool) bool {
+	if len(b.pools) != len(pools) {
+		return false
+	}
+	for i, p := range pools {
+		if b.pools[i] != p || b.weights[i] != p.Weight() {
+			return false
+		}
+	}
+	return true
+}
+
+func hashKey(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,111 @@
+package pool
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testPools(weights ...int) []*Pool {
+	pools := make([]*Pool, len(weights))
+	for i, w := range weights {
+		pools[i] = &Pool{address: "replica" + string(rune('a'+i))}
+		pools[i].setWeight(w)
+	}
+	return pools
+}
+
+func TestNewBalancer_Unknown(t *testing.T) {
+	if _, err := NewBalancer("random"); err == nil {
+		t.Error("NewBalancer() expected error for unknown strategy, got nil")
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	pools := testPools(3, 1)
+	b, _ := NewBalancer(BalanceRoundRobin)
+
+	counts := make(map[*Pool]int)
+	for i := 0; i < 8; i++ {
+		counts[b.Pick(pools, "")]++
+	}
+	if counts[pools[0]] != 6 || counts[pools[1]] != 2 {
+		t.Errorf("weighted round-robin counts = %d/%d, want 6/2", counts[pools[0]], counts[pools[1]])
+	}
+
+	// scores of pools no longer passed in are dropped
+	b.Pick(pools[1:], "")
+	if wrr := b.(*weightedRoundRobin); len(wrr.current) != 1 {
+		t.Errorf("weighted round-robin tracks %d pools after one was removed, want 1", len(wrr.current))
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	pools := testPools(1, 1, 2)
+	pools[0].inUse.Store(3)
+	pools[1].inUse.Store(1)
+	pools[2].inUse.Store(3)
+	b, _ := NewBalancer(BalanceLeastConn)
+
+	if got := b.Pick(pools, ""); got != pools[1] {
+		t.Errorf("least_conn picked %s, want %s", got.Address(), pools[1].Address())
+	}
+	pools[1].inUse.Store(2)
+	// 3/2 on the weighted pool beats 2/1
+	if got := b.Pick(pools, ""); got != pools[2] {
+		t.Errorf("least_conn picked %s, want %s", got.Address(), pools[2].Address())
+	}
+}
+
+func TestPowerOfTwo(t *testing.T) {
+	pools := testPools(1, 1)
+	pools[0].Observe(50*time.Millisecond, false)
+	pools[1].Observe(time.Millisecond, false)
+	b, _ := NewBalancer(BalancePowerOfTwo)
+
+	for i := 0; i < 10; i++ {
+		if got := b.Pick(pools, ""); got != pools[1] {
+			t.Fatalf("p2c picked %s, want the faster %s", got.Address(), pools[1].Address())
+		}
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	pools := testPools(1, 1, 1)
+	b, _ := NewBalancer(BalanceConsistentHash)
+
+	first := b.Pick(pools, "client-42")
+	for i := 0; i < 10; i++ {
+		if got := b.Pick(pools, "client-42"); got != first {
+			t.Fatalf("consistent_hash moved client-42 from %s to %s", first.Address(), got.Address())
+		}
+	}
+
+	seen := make(map[*Pool]bool)
+	for i := 0; i < 100; i++ {
+		seen[b.Pick(pools, "client-"+string(rune('0'+i)))] = true
+	}
+	if len(seen) != len(pools) {
+		t.Errorf("consistent_hash used %d of %d pools", len(seen), len(pools))
+	}
+}
+
+func TestConsistentHash_WeightChange(t *testing.T) {
+	pools := testPools(1, 1)
+	b, _ := NewBalancer(BalanceConsistentHash)
+	share := func() int {
+		n := 0
+		for i := range 1000 {
+			if b.Pick(pools, "client-"+strconv.Itoa(i)) == pools[0] {
+				n++
+			}
+		}
+		return n
+	}
+
+	before := share()
+	pools[0].setWeight(9) // as SetGroup does on reload
+	if after := share(); after < 800 || after <= before {
+		t.Errorf("%s got %d of 1000 keys after its weight went from 1 to 9 (%d before), want most", pools[0].Address(), after, before)
+	}
+}
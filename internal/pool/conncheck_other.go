@@ -0,0 +1,11 @@
+//go:build !unix
+
+package pool
+
+import "net"
+
+// peekAlive cannot inspect the socket on this platform; dead connections are
+// left to the ping check and TCP keepalive.
+func peekAlive(conn net.Conn) bool {
+	return true
+}
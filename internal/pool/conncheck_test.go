@@ -0,0 +1,103 @@
+//go:build unix
+
+package pool
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// connPair returns a dialed connection and the server side of it.
+func connPair(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	client, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-accepted
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestPeekAlive(t *testing.T) {
+	client, _ := connPair(t)
+	if !peekAlive(client) {
+		t.Error("peekAlive() = false for an idle open connection")
+	}
+	// the check must not leave a deadline behind
+	client.SetReadDeadline(time.Time{})
+
+	client, server := connPair(t)
+	server.Close()
+	time.Sleep(20 * time.Millisecond)
+	if peekAlive(client) {
+		t.Error("peekAlive() = true after the peer closed the connection")
+	}
+
+	client, server = connPair(t)
+	server.Write([]byte("E"))
+	time.Sleep(20 * time.Millisecond)
+	if peekAlive(client) {
+		t.Error("peekAlive() = true with unsolicited data pending")
+	}
+
+	client, _ = connPair(t)
+	client.Close()
+	if peekAlive(client) {
+		t.Error("peekAlive() = true for a locally closed connection")
+	}
+}
+
+func TestPool_PingIdleConnections(t *testing.T) {
+	p := &Pool{cfg: Config{PingIdleThreshold: time.Minute}}
+
+	client, server := connPair(t)
+	go func() {
+		buf := make([]byte, 6)
+		if _, err := io.ReadFull(server, buf); err != nil {
+			return
+		}
+		// EmptyQueryResponse then ReadyForQuery(idle)
+		server.Write([]byte{'I', 0, 0, 0, 4, 'Z', 0, 0, 0, 5, 'I'})
+	}()
+	if !p.isConnAlive(&PooledConn{Conn: client, started: true}, 2*time.Minute) {
+		t.Error("isConnAlive() = false for a connection answering the ping")
+	}
+
+	// no ping is sent below the threshold or before startup, so a silent
+	// server is fine
+	tests := []struct {
+		name    string
+		started bool
+		idleFor time.Duration
+	}{
+		{"idle below the threshold", true, time.Second},
+		{"without startup", false, 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		client, _ = connPair(t)
+		start := time.Now()
+		if !p.isConnAlive(&PooledConn{Conn: client, started: tt.started}, tt.idleFor) {
+			t.Errorf("isConnAlive() = false for a connection %s", tt.name)
+		}
+		if time.Since(start) > pingTimeout/2 {
+			t.Errorf("isConnAlive() pinged a connection %s", tt.name)
+		}
+	}
+}
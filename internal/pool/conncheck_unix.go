@@ -0,0 +1,38 @@
+//go:build unix
+
+package pool
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// peekAlive looks at the socket without consuming data or touching
+// deadlines. An idle backend connection should have nothing to read: EOF
+// means the server closed it, and unsolicited data is usually a FATAL sent
+// just before closing.
+func peekAlive(conn net.Conn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return true
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	alive := false
+	var buf [1]byte
+	err = rc.Read(func(fd uintptr) bool {
+		for {
+			n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			alive = n <= 0 && (errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EWOULDBLOCK))
+			return true
+		}
+	})
+	return err == nil && alive
+}
@@ -0,0 +1,158 @@
+package pool
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// DefaultDrainTimeout bounds how long Remove waits for connections in use
+// when no timeout was configured.
+const DefaultDrainTimeout = 30 * time.Second
+
+// drainPollInterval is how often Remove checks for returned connections.
+var drainPollInterval = 10 * time.Millisecond
+
+var (
+	ErrUnknownBackend = errors.New("unknown backend")
+	ErrDrainPrimary   = errors.New("the primary cannot be drained")
+)
+
+// Draining reports whether the pool has been taken out of rotation by Drain.
+func (p *Pool) Draining() bool {
+	return p.draining.Load()
+}
+
+// Drain takes every replica pool with the given address out of rotation:
+// sessions no longer pick it for new reads, while connections already
+// handed out keep working.
+func (pm *PoolManager) Drain(address string) error {
+	_, err := pm.drain(address)
+	return err
+}
+
+func (pm *PoolManager) drain(address string) ([]*Pool, error) {
+	if address == pm.RWPool.Address() {
+		return nil, ErrDrainPrimary
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	var pools []*Pool
+	for _, g := range pm.groups {
+		for _, p := range g.pools {
+			if p.address == address {
+				pm.setDrainingLocked(p)
+				pools = append(pools, p)
+			}
+		}
+	}
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrUnknownBackend, address)
+	}
+	slog.Info("draining replica", "backend", address)
+	return pools, nil
+}
+
+// Remove drains the replica pools with the given address, waits until the
+// connections handed out are returned or ctx ends, then closes the pools and
+// removes them from their groups. Connections still in use at that point are
+// closed when they are returned, and the error reports them.
+func (pm *PoolManager) Remove(ctx context.Context, address string) error {
+	pools, err := pm.drain(address)
+	if err != nil {
+		return err
+	}
+	inUse := waitReleased(ctx, pools)
+
+	pm.mu.Lock()
+	for _, g := range pm.groups {
+		g.pools = slices.DeleteFunc(g.pools, func(p *Pool) bool { return slices.Contains(pools, p) })
+	}
+	pm.mu.Unlock()
+	for _, p := range pools {
+		p.Close()
+	}
+
+	if inUse > 0 {
+		slog.Warn("removed replica with connections still in use", "backend", address, "in_use", inUse)
+		return fmt.Errorf("removed %s with %d connections still in use: %w", address, inUse, ctx.Err())
+	}
+	slog.Info("removed replica", "backend", address)
+	return nil
+}
+
+// OnRetire registers f to be called with every replica pool taken out of
+// rotation by Drain, Remove, SetGroup or RemoveGroup, so references to it can
+// be dropped and connections held on it returned. f is called with the
+// PoolManager locked and must not call its methods that lock it.
+func (pm *PoolManager) OnRetire(f func(*Pool)) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.onRetire = f
+}
+
+// setDrainingLocked takes p out of rotation. Called with pm.mu held.
+func (pm *PoolManager) setDrainingLocked(p *Pool) {
+	p.draining.Store(true)
+	if pm.onRetire != nil {
+		pm.onRetire(p)
+	}
+}
+
+// SetDrainTimeout bounds how long pools dropped by SetGroup or RemoveGroup
+// may keep connections in use before they are closed.
+func (pm *PoolManager) SetDrainTimeout(d time.Duration) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.drainTimeout = d
+}
+
+// retire closes pools already taken out of their group once their
+// connections are returned, waiting at most the drain timeout. Called with
+// pm.mu held; the wait happens in the background.
+func (pm *PoolManager) retire(pools []*Pool) {
+	if len(pools) == 0 {
+		return
+	}
+	for _, p := range pools {
+		pm.setDrainingLocked(p)
+		slog.Info("draining replica", "backend", p.address)
+	}
+	timeout := cmp.Or(pm.drainTimeout, DefaultDrainTimeout)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		for _, p := range pools {
+			if inUse := waitReleased(ctx, []*Pool{p}); inUse > 0 {
+				slog.Warn("removed replica with connections still in use", "backend", p.address, "in_use", inUse)
+			} else {
+				slog.Info("removed replica", "backend", p.address)
+			}
+			p.Close()
+		}
+	}()
+}
+
+// waitReleased waits until no connection of pools is in use or ctx ends,
+// and returns the number still in use.
+func waitReleased(ctx context.Context, pools []*Pool) int64 {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		var inUse int64
+		for _, p := range pools {
+			inUse += p.InUse()
+		}
+		if inUse == 0 || ctx.Err() != nil {
+			return inUse
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
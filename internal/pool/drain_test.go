@@ -0,0 +1,181 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPoolManager_Drain(t *testing.T) {
+	primary := startMockBackend(t)
+	a := startMockBackend(t)
+	b := startMockBackend(t)
+
+	pm := NewPoolManager(primary, []Node{{Address: a}, {Address: b}}, 2, 2, time.Minute)
+	defer pm.Close()
+
+	if err := pm.Drain(primary); !errors.Is(err, ErrDrainPrimary) {
+		t.Errorf("Drain(primary) error = %v, want %v", err, ErrDrainPrimary)
+	}
+	if err := pm.Drain("127.0.0.1:1"); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("Drain(unknown) error = %v, want %v", err, ErrUnknownBackend)
+	}
+
+	// a connection taken before the drain stays usable
+	held, heldPool, err := pm.GetROGroup(DefaultGroup, "")
+	if err != nil {
+		t.Fatalf("GetROGroup() error = %v", err)
+	}
+	if err := pm.Drain(a); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		conn, p, err := pm.GetROGroup(DefaultGroup, "")
+		if err != nil {
+			t.Fatalf("GetROGroup() error = %v", err)
+		}
+		if p.Address() != b {
+			t.Errorf("GetROGroup() picked %s, want %s", p.Address(), b)
+		}
+		pm.PutRO(conn, p)
+	}
+	pm.PutRO(held, heldPool)
+
+	// with every replica drained, reads go to the primary
+	if err := pm.Drain(b); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	conn, p, err := pm.GetROGroup(DefaultGroup, "")
+	if err != nil {
+		t.Fatalf("GetROGroup() error = %v", err)
+	}
+	if p != pm.RWPool {
+		t.Errorf("GetROGroup() picked %s, want the primary", p.Address())
+	}
+	pm.PutRW(conn)
+
+	for _, st := range pm.Stats()[1:] {
+		if !st.Draining {
+			t.Errorf("Stats() %s draining = false, want true", st.Address)
+		}
+	}
+}
+
+func TestPoolManager_Remove(t *testing.T) {
+	primary := startMockBackend(t)
+	a := startMockBackend(t)
+	b := startMockBackend(t)
+
+	pm := NewPoolManager(primary, []Node{{Address: a}, {Address: b}}, 2, 2, time.Minute)
+	defer pm.Close()
+	pm.AddGroup("analytics", []Node{{Address: a}}, 2, nil)
+
+	conn, held, err := pm.GetROGroup("analytics", "")
+	if err != nil {
+		t.Fatalf("GetROGroup() error = %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pm.PutRO(conn, held)
+	}()
+	if err := pm.Remove(context.Background(), a); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if st := pm.Stats(); len(st) != 2 || st[1].Address != b {
+		t.Errorf("after Remove() Stats() = %+v, want the primary and %s", st, b)
+	}
+	conn, p, err := pm.GetROGroup("analytics", "")
+	if err != nil {
+		t.Fatalf("GetROGroup() error = %v", err)
+	}
+	if p.Address() != b {
+		t.Errorf("GetROGroup() on an emptied group picked %s, want %s", p.Address(), b)
+	}
+	pm.PutRO(conn, p)
+
+	// connections still in use when the timeout expires are closed on return
+	conn, held, err = pm.GetROGroup(DefaultGroup, "")
+	if err != nil {
+		t.Fatalf("GetROGroup() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pm.Remove(ctx, b); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Remove() with a connection in use error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	pm.PutRO(conn, held)
+	if st := held.Stats(); st.Open != 0 {
+		t.Errorf("after Put() on a removed pool open = %d, want 0", st.Open)
+	}
+}
+
+func TestPoolManager_SetGroup(t *testing.T) {
+	primary := startMockBackend(t)
+	a := startMockBackend(t)
+	b := startMockBackend(t)
+
+	pm := NewPoolManager(primary, []Node{{Address: a}}, 2, 2, time.Minute)
+	defer pm.Close()
+	pm.SetDrainTimeout(time.Second)
+
+	conn, held, err := pm.GetROGroup(DefaultGroup, "")
+	if err != nil {
+		t.Fatalf("GetROGroup() error = %v", err)
+	}
+	pm.SetGroup(DefaultGroup, []Node{{Address: a, Weight: 3}, {Address: b}}, 4, nil)
+	if p := pm.groups[DefaultGroup].pools[0]; p != held || p.Weight() != 3 || p.config().MaxSize != 4 {
+		t.Errorf("SetGroup() on a kept node: same pool %v, weight %d, max size %d", p == held, p.Weight(), p.config().MaxSize)
+	}
+
+	// a dropped node is drained and closed once its connections are back
+	pm.SetGroup(DefaultGroup, []Node{{Address: b}}, 4, nil)
+	if !held.Draining() {
+		t.Errorf("SetGroup() left the dropped pool accepting connections")
+	}
+	pm.PutRO(conn, held)
+	deadline := time.Now().Add(time.Second)
+	for held.Stats().Open != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if st := held.Stats(); st.Open != 0 {
+		t.Errorf("dropped pool open = %d, want 0", st.Open)
+	}
+	if st := pm.Stats(); len(st) != 2 || st[1].Address != b {
+		t.Errorf("after SetGroup() Stats() = %+v, want the primary and %s", st, b)
+	}
+
+	pm.SetGroup("analytics", []Node{{Address: a}}, 2, nil)
+	if names := pm.GroupNames(); len(names) != 2 || names[1] != "analytics" {
+		t.Errorf("GroupNames() = %v, want [default analytics]", names)
+	}
+	pm.RemoveGroup("analytics")
+	pm.RemoveGroup(DefaultGroup)
+	if names := pm.GroupNames(); len(names) != 1 || names[0] != DefaultGroup {
+		t.Errorf("after RemoveGroup() GroupNames() = %v, want [default]", names)
+	}
+	conn, p, err := pm.GetROGroup(DefaultGroup, "")
+	if err != nil {
+		t.Fatalf("GetROGroup() error = %v", err)
+	}
+	if p != pm.RWPool {
+		t.Errorf("GetROGroup() on an empty group picked %s, want the primary", p.Address())
+	}
+	pm.PutRW(conn)
+}
+
+func TestPoolManager_OnRetire(t *testing.T) {
+	pm := NewPoolManager("127.0.0.1:1", []Node{{Address: "127.0.0.1:2"}, {Address: "127.0.0.1:3"}}, 1, 1, time.Minute)
+	defer pm.Close()
+	var retired []string
+	pm.OnRetire(func(p *Pool) { retired = append(retired, p.Address()) })
+
+	if err := pm.Drain("127.0.0.1:2"); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	pm.SetGroup(DefaultGroup, []Node{{Address: "127.0.0.1:2"}}, 1, nil)
+	if want := []string{"127.0.0.1:2", "127.0.0.1:3"}; !slices.Equal(retired, want) {
+		t.Errorf("OnRetire called with %q, want %q", retired, want)
+	}
+}
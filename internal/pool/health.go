@@ -0,0 +1,179 @@
+package pool
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// healthDecay is the weight given to each new latency or error sample.
+const healthDecay = 0.2
+
+// health tracks how a backend has been behaving from the proxy's point of
+// view, for latency-aware balancing and outlier ejection.
+type health struct {
+	mu           sync.Mutex
+	latency      time.Duration // EWMA of successful round trips
+	errorRate    float64       // EWMA of failed round trips, 0..1
+	failures     int           // consecutive failures
+	ejectedUntil time.Time
+	ejections    int
+}
+
+// Observe records one round trip against the backend. Latency is only
+// folded into the average for successful round trips.
+func (p *Pool) Observe(d time.Duration, failed bool) {
+	h := &p.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if failed {
+		h.failures++
+		h.errorRate = healthDecay + (1-healthDecay)*h.errorRate
+		return
+	}
+	h.failures = 0
+	h.errorRate = (1 - healthDecay) * h.errorRate
+	if h.latency == 0 {
+		h.latency = d
+		return
+	}
+	h.latency = time.Duration(healthDecay*float64(d) + (1-healthDecay)*float64(h.latency))
+}
+
+// Latency returns the moving average of observed query latency, or zero if
+// nothing has been observed yet.
+func (p *Pool) Latency() time.Duration {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	return p.health.latency
+}
+
+// ErrorRate returns the moving average of failed round trips.
+func (p *Pool) ErrorRate() float64 {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	return p.health.errorRate
+}
+
+// Ejected reports whether outlier detection has taken the pool out of rotation.
+func (p *Pool) Ejected() bool {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	return time.Now().Before(p.health.ejectedUntil)
+}
+
+// score is the latency penalised by the error rate; lower is better.
+func (p *Pool) score() float64 {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	return float64(p.health.latency) * (1 + 4*p.health.errorRate)
+}
+
+// OutlierConfig controls when a replica is temporarily ejected from its group.
+type OutlierConfig struct {
+	ConsecutiveFailures int           // eject after this many failures in a row
+	ErrorRate           float64       // eject when the error EWMA exceeds this
+	LatencyFactor       float64       // eject when latency exceeds this multiple of the group median
+	EjectionTime        time.Duration // base ejection, multiplied by the number of ejections
+	MaxEjectionPercent  int           // never eject more than this share of a group
+	Interval            time.Duration // how often a group is evaluated
+}
+
+func DefaultOutlierConfig() OutlierConfig {
+	return OutlierConfig{
+		ConsecutiveFailures: 5,
+		ErrorRate:           0.5,
+		LatencyFactor:       3,
+		EjectionTime:        30 * time.Second,
+		MaxEjectionPercent:  50,
+		Interval:            time.Second,
+	}
+}
+
+// withDefaults fills zero fields from DefaultOutlierConfig.
+func (c OutlierConfig) withDefaults() OutlierConfig {
+	d := DefaultOutlierConfig()
+	if c.ConsecutiveFailures == 0 {
+		c.ConsecutiveFailures = d.ConsecutiveFailures
+	}
+	if c.ErrorRate == 0 {
+		c.ErrorRate = d.ErrorRate
+	}
+	if c.LatencyFactor == 0 {
+		c.LatencyFactor = d.LatencyFactor
+	}
+	if c.EjectionTime == 0 {
+		c.EjectionTime = d.EjectionTime
+	}
+	if c.MaxEjectionPercent == 0 {
+		c.MaxEjectionPercent = d.MaxEjectionPercent
+	}
+	if c.Interval == 0 {
+		c.Interval = d.Interval
+	}
+	return c
+}
+
+// detectOutliers ejects misbehaving pools of a group and readmits those whose
+// ejection has expired. Called with the PoolManager lock held.
+func (c OutlierConfig) detectOutliers(pools []*Pool, now time.Time) {
+	ejected := 0
+	var latencies []time.Duration
+	for _, p := range pools {
+		h := &p.health
+		h.mu.Lock()
+		switch {
+		case now.Before(h.ejectedUntil):
+			ejected++
+		case !h.ejectedUntil.IsZero():
+			// back in rotation with a clean slate
+			h.ejectedUntil = time.Time{}
+			h.failures = 0
+			h.errorRate = 0
+			h.latency = 0
+			slog.Info("replica returned to rotation", "backend", p.address)
+		}
+		if now.After(h.ejectedUntil) && h.latency > 0 {
+			latencies = append(latencies, h.latency)
+		}
+		h.mu.Unlock()
+	}
+
+	var median time.Duration
+	if len(latencies) >= 2 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		median = latencies[len(latencies)/2]
+	}
+
+	maxEjected := len(pools) * c.MaxEjectionPercent / 100
+	for _, p := range pools {
+		if ejected >= maxEjected {
+			return
+		}
+		h := &p.health
+		h.mu.Lock()
+		if now.Before(h.ejectedUntil) {
+			h.mu.Unlock()
+			continue
+		}
+		var reason string
+		switch {
+		case h.failures >= c.ConsecutiveFailures:
+			reason = "consecutive failures"
+		case h.errorRate > c.ErrorRate:
+			reason = "error rate"
+		case median > 0 && float64(h.latency) > c.LatencyFactor*float64(median):
+			reason = "latency"
+		}
+		if reason != "" {
+			h.ejections++
+			mult := min(h.ejections, 10)
+			h.ejectedUntil = now.Add(time.Duration(mult) * c.EjectionTime)
+			ejected++
+			slog.Warn("ejecting replica", "backend", p.address, "duration", time.Duration(mult)*c.EjectionTime, "reason", reason)
+		}
+		h.mu.Unlock()
+	}
+}
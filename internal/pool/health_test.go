@@ -0,0 +1,93 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPool_Observe(t *testing.T) {
+	p := &Pool{}
+	p.Observe(100*time.Millisecond, false)
+	if p.Latency() != 100*time.Millisecond {
+		t.Errorf("first sample Latency() = %v, want %v", p.Latency(), 100*time.Millisecond)
+	}
+	p.Observe(0, false)
+	if want := 80 * time.Millisecond; p.Latency() != want {
+		t.Errorf("Latency() = %v, want %v", p.Latency(), want)
+	}
+
+	p.Observe(time.Second, true)
+	if p.Latency() != 80*time.Millisecond {
+		t.Errorf("failed sample changed Latency() to %v", p.Latency())
+	}
+	if p.ErrorRate() == 0 {
+		t.Error("ErrorRate() = 0 after a failure")
+	}
+}
+
+func TestDetectOutliers_ConsecutiveFailures(t *testing.T) {
+	pools := testPools(1, 1)
+	for i := 0; i < 5; i++ {
+		pools[0].Observe(0, true)
+	}
+	c := DefaultOutlierConfig()
+	now := time.Now()
+	c.detectOutliers(pools, now)
+
+	if !pools[0].Ejected() {
+		t.Error("failing replica was not ejected")
+	}
+	if pools[1].Ejected() {
+		t.Error("healthy replica was ejected")
+	}
+
+	g := &replicaGroup{pools: pools}
+	if avail := g.available(); len(avail) != 1 || avail[0] != pools[1] {
+		t.Errorf("available() = %v, want only the healthy replica", avail)
+	}
+
+	// after the ejection expires the replica is readmitted with a clean slate
+	c.detectOutliers(pools, now.Add(c.EjectionTime+time.Second))
+	pools[0].health.mu.Lock()
+	readmitted := pools[0].health.ejectedUntil.IsZero() && pools[0].health.failures == 0
+	pools[0].health.mu.Unlock()
+	if !readmitted {
+		t.Error("replica was not readmitted after its ejection expired")
+	}
+}
+
+func TestDetectOutliers_Latency(t *testing.T) {
+	pools := testPools(1, 1, 1)
+	pools[0].Observe(10*time.Millisecond, false)
+	pools[1].Observe(12*time.Millisecond, false)
+	pools[2].Observe(200*time.Millisecond, false)
+
+	DefaultOutlierConfig().detectOutliers(pools, time.Now())
+
+	if !pools[2].Ejected() {
+		t.Error("slow replica was not ejected")
+	}
+	if pools[0].Ejected() || pools[1].Ejected() {
+		t.Error("fast replica was ejected")
+	}
+}
+
+func TestDetectOutliers_MaxEjectionPercent(t *testing.T) {
+	pools := testPools(1, 1)
+	for _, p := range pools {
+		for i := 0; i < 5; i++ {
+			p.Observe(0, true)
+		}
+	}
+	DefaultOutlierConfig().detectOutliers(pools, time.Now())
+
+	ejected := 0
+	for _, p := range pools {
+		if p.Ejected() {
+			ejected++
+		}
+	}
+	if ejected != 1 {
+		t.Errorf("%d of 2 replicas ejected, want 1", ejected)
+	}
+}
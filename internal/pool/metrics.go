@@ -0,0 +1,23 @@
+package pool
+
+import "github.com/user/pggate/internal/metrics"
+
+// Process-wide pool metrics. Per-node figures are exported by the
+// PoolManager collector in stats.go.
+var (
+	rwConnectionsOpen = metrics.NewGauge("pggate_backend_rw_connections_open", "Current number of open connections to the primary")
+	roConnectionsOpen = metrics.NewGauge("pggate_backend_ro_connections_open", "Current number of open connections to replicas")
+	waitingClients    = metrics.NewGauge("pggate_pool_waiting_clients", "Current number of requests queued for a backend connection")
+	waits             = metrics.NewCounter("pggate_pool_waits_total", "Total number of requests that queued for a backend connection")
+	waitSeconds       = metrics.NewCounter("pggate_pool_wait_seconds_total", "Total time spent queued for a backend connection")
+	acquireTimeouts   = metrics.NewCounter("pggate_pool_acquire_timeouts_total", "Total number of requests that timed out waiting for a backend connection")
+	staleConnections  = metrics.NewCounter("pggate_pool_stale_connections_total", "Total number of dead idle backend connections discarded by liveness checks")
+)
+
+// connectionsOpen returns the open connections gauge of a pool role.
+func connectionsOpen(role string) *metrics.Gauge {
+	if role == RolePrimary {
+		return rwConnectionsOpen
+	}
+	return roConnectionsOpen
+}
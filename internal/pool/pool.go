@@ -1,137 +1,683 @@
 package pool
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
 	"net"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/metrics"
+)
+
+// DefaultAcquireTimeout bounds how long Get waits for a connection when the
+// pool is at its maximum size and no timeout was configured.
+const DefaultAcquireTimeout = 30 * time.Second
+
+var (
+	// ErrAcquireTimeout is returned by Get when no connection became free
+	// within the acquire timeout.
+	ErrAcquireTimeout = errors.New("timed out waiting for a free backend connection")
+	ErrPoolClosed     = errors.New("pool is closed")
 )
 
+// maintenanceInterval is how often a pool evicts and replenishes idle
+// connections.
+var maintenanceInterval = time.Second
+
+// lifetimeJitter is the largest fraction shaved off MaxLifetime per
+// connection so connections dialed together do not expire together.
+const lifetimeJitter = 0.1
+
 type PooledConn struct {
 	Conn     net.Conn
 	lastUsed time.Time
+	started  bool // completed startup, so it can answer a ping
+}
+
+// Config holds the sizing and timeout settings of a single pool.
+type Config struct {
+	Role           string        // primary or replica, used as a metrics label
+	MaxSize        int           // hard cap on open connections, idle and in use; <= 0 means unbounded
+	MinIdle        int           // idle connections kept ready, dialed in the background
+	MaxIdle        int           // idle connections beyond this are closed on return; <= 0 means MaxSize
+	IdleTimeout    time.Duration // idle connections above MinIdle older than this are closed; <= 0 disables
+	MaxLifetime    time.Duration // connections are recycled after this long, minus jitter; <= 0 disables
+	AcquireTimeout time.Duration // how long Get queues when the pool is full
+
+	// PingIdleThreshold sends an empty query on connections idle longer than
+	// this before handing them out; <= 0 disables. Only connections marked
+	// with MarkStarted are pinged, the others are checked by peek and TCP
+	// keepalive alone.
+	PingIdleThreshold time.Duration
+	KeepAlive         net.KeepAliveConfig // TCP keepalive on dialed connections
+}
+
+// pingTimeout bounds the empty-query round trip of a liveness ping.
+const pingTimeout = 2 * time.Second
+
+// waiter is a Get blocked on a full pool. It receives either a connection
+// handed over by Put, or nil as a permit to dial a new one. The channel is
+// closed when the pool shuts down.
+type waiter struct {
+	ch chan *PooledConn
 }
 
 type Pool struct {
-	address     string
-	connections chan *PooledConn
-	maxSize     int
-	idleTimeout time.Duration
-	mu          sync.Mutex
+	address string
+	role    string
+	cfg     Config // guarded by mu, see SetConfig
+	mu      sync.Mutex
+	idle    []*PooledConn // most recently used last
+	open    int           // idle + in use + being dialed
+	waiters []*waiter     // FIFO
+	closed  bool
+	done    chan struct{}
+	resumed chan struct{}          // non-nil while paused, closed by Resume
+	expires map[net.Conn]time.Time // lifetime deadline per open connection
+	started map[net.Conn]bool      // open connections that completed startup
+	dialErr bool                   // last background dial failed, to log only once
+
+	weight      atomic.Int64
+	inUse       atomic.Int64 // connections handed out and not yet returned
+	draining    atomic.Bool  // out of rotation, see PoolManager.Drain
+	dialFailing atomic.Bool  // the last dial failed
+	health      health
+	stats       counters
 }
 
 func NewPool(address string, maxSize int, idleTimeout time.Duration) *Pool {
+	return NewPoolWithConfig(address, Config{MaxSize: maxSize, IdleTimeout: idleTimeout})
+}
+
+func NewPoolWithConfig(address string, cfg Config) *Pool {
 	p := &Pool{
-		address:     address,
-		maxSize:     maxSize,
-		idleTimeout: idleTimeout,
-		connections: make(chan *PooledConn, maxSize),
+		address: address,
+		role:    cfg.Role,
+		cfg:     cfg.withDefaults(),
+		done:    make(chan struct{}),
+		expires: make(map[net.Conn]time.Time),
+		started: make(map[net.Conn]bool),
 	}
+	p.weight.Store(1)
+	p.stats.dialLatency = metrics.NewHistogram(metrics.DefaultLatencyBuckets)
 
-	for i := 0; i < maxSize/2; i++ {
-		conn, err := p.createConn()
-		if err == nil {
-			p.connections <- &PooledConn{Conn: conn, lastUsed: time.Now()}
-		}
+	// warm up in the background so a backend that is down doesn't block startup
+	go p.maintain()
+
+	return p
+}
+
+func (c Config) withDefaults() Config {
+	if c.AcquireTimeout <= 0 {
+		c.AcquireTimeout = DefaultAcquireTimeout
+	}
+	if c.MaxSize > 0 && c.MinIdle > c.MaxSize {
+		c.MinIdle = c.MaxSize
 	}
+	return c
+}
 
-	go p.cleanupIdleConnections()
+// config returns the current settings of the pool.
+func (p *Pool) config() Config {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cfg
+}
 
-	return p
+// SetConfig changes the settings of a running pool; the role is kept. Idle
+// connections over the new limits are closed right away, connections in use
+// over MaxSize when they are returned, and waiters get the slots of a larger
+// pool. KeepAlive and MaxLifetime apply to connections dialed afterwards.
+func (p *Pool) SetConfig(cfg Config) {
+	cfg.Role = p.role
+	cfg = cfg.withDefaults()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = cfg
+	if p.closed {
+		return
+	}
+	for len(p.idle) > 0 && (p.overSizeLocked() || cfg.MaxIdle > 0 && len(p.idle) > cfg.MaxIdle) {
+		p.evictLocked(p.idle[0].Conn, EvictResized)
+		p.idle = p.idle[1:]
+		p.open--
+	}
+	for len(p.waiters) > 0 && p.resumed == nil && (cfg.MaxSize <= 0 || p.open < cfg.MaxSize) {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		p.open++
+		w.ch <- nil
+	}
+}
+
+// overSizeLocked reports whether the pool holds more connections than
+// MaxSize allows, after it was shrunk. Called with p.mu held.
+func (p *Pool) overSizeLocked() bool {
+	return p.cfg.MaxSize > 0 && p.open > p.cfg.MaxSize
 }
 
 func (p *Pool) createConn() (net.Conn, error) {
-	return net.Dial("tcp", p.address)
+	cfg := p.config()
+	d := net.Dialer{KeepAliveConfig: cfg.KeepAlive}
+	start := time.Now()
+	conn, err := d.Dial("tcp", p.address)
+	p.stats.dialLatency.ObserveDuration(time.Since(start))
+	p.dialFailing.Store(err != nil)
+	if err != nil {
+		p.stats.dialFailures.Add(1)
+		return nil, err
+	}
+	p.stats.dialed.Add(1)
+	connectionsOpen(p.role).Inc()
+	if cfg.MaxLifetime > 0 {
+		jitter := time.Duration(rand.Float64() * lifetimeJitter * float64(cfg.MaxLifetime))
+		p.mu.Lock()
+		p.expires[conn] = time.Now().Add(cfg.MaxLifetime - jitter)
+		p.mu.Unlock()
+	}
+	return conn, nil
+}
+
+// closeLocked closes a connection that has left the pool's accounting.
+// Called with p.mu held.
+func (p *Pool) closeLocked(conn net.Conn) {
+	delete(p.expires, conn)
+	delete(p.started, conn)
+	conn.Close()
+	connectionsOpen(p.role).Dec()
+}
+
+// expiredLocked reports whether conn has outlived MaxLifetime. Called with
+// p.mu held.
+func (p *Pool) expiredLocked(conn net.Conn, now time.Time) bool {
+	deadline, ok := p.expires[conn]
+	return ok && now.After(deadline)
+}
+
+func (p *Pool) Address() string {
+	return p.address
+}
+
+// Role is primary or replica.
+func (p *Pool) Role() string {
+	return p.role
 }
 
+// Weight is the relative share of traffic this pool should receive.
+func (p *Pool) Weight() int {
+	if w := p.weight.Load(); w > 1 {
+		return int(w)
+	}
+	return 1
+}
+
+func (p *Pool) setWeight(w int) {
+	p.weight.Store(int64(w))
+}
+
+// InUse reports how many connections are currently checked out.
+func (p *Pool) InUse() int64 {
+	return p.inUse.Load()
+}
+
+// Get returns an idle connection, dials a new one if the pool is below its
+// maximum size, or otherwise queues until a connection is returned or the
+// acquire timeout expires.
 func (p *Pool) Get() (net.Conn, error) {
+	start := time.Now()
+	conn, err := p.get()
+	if err != nil {
+		if !errors.Is(err, ErrAcquireTimeout) && !errors.Is(err, ErrPoolClosed) {
+			p.Observe(0, true)
+		}
+		return nil, err
+	}
+	p.inUse.Add(1)
+	p.stats.acquired.Add(1)
+	p.stats.acquireNanos.Add(int64(time.Since(start)))
+	return conn, nil
+}
+
+func (p *Pool) get() (net.Conn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if resumed := p.resumed; resumed != nil {
+			p.mu.Unlock()
+			if err := p.waitResumed(resumed); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if n := len(p.idle); n > 0 {
+			pooled := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			if p.expiredLocked(pooled.Conn, time.Now()) {
+				p.evictLocked(pooled.Conn, EvictMaxLifetime)
+				p.mu.Unlock()
+				p.release()
+				continue
+			}
+			p.mu.Unlock()
+			if !p.isConnAlive(pooled, time.Since(pooled.lastUsed)) {
+				staleConnections.Inc()
+				p.mu.Lock()
+				p.evictLocked(pooled.Conn, EvictStale)
+				p.mu.Unlock()
+				p.release()
+				continue
+			}
+			pooled.lastUsed = time.Now()
+			return pooled.Conn, nil
+		}
+		if p.cfg.MaxSize <= 0 || p.open < p.cfg.MaxSize {
+			p.open++
+			p.mu.Unlock()
+			return p.dial()
+		}
+
+		w := &waiter{ch: make(chan *PooledConn, 1)}
+		p.waiters = append(p.waiters, w)
+		p.mu.Unlock()
+
+		pooled, err := p.wait(w)
+		if err != nil {
+			return nil, err
+		}
+		if pooled == nil {
+			// a slot was freed for us
+			return p.dial()
+		}
+		pooled.lastUsed = time.Now()
+		return pooled.Conn, nil
+	}
+}
+
+// wait blocks until w is served or the acquire timeout expires.
+func (p *Pool) wait(w *waiter) (*PooledConn, error) {
+	waitingClients.Inc()
+	defer waitingClients.Dec()
+	start := time.Now()
+	defer func() {
+		waits.Inc()
+		waitSeconds.Add(time.Since(start).Seconds())
+	}()
+
+	timeout := p.config().AcquireTimeout
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case pooled, ok := <-w.ch:
+		if !ok {
+			return nil, ErrPoolClosed
+		}
+		return pooled, nil
+	case <-timer.C:
+	}
+
+	p.mu.Lock()
+	if i := slices.Index(p.waiters, w); i >= 0 {
+		p.waiters = slices.Delete(p.waiters, i, i+1)
+		p.mu.Unlock()
+		acquireTimeouts.Inc()
+		return nil, fmt.Errorf("%w after %v", ErrAcquireTimeout, timeout)
+	}
+	p.mu.Unlock()
+	// served while we were timing out
+	pooled, ok := <-w.ch
+	if !ok {
+		return nil, ErrPoolClosed
+	}
+	return pooled, nil
+}
+
+// waitResumed blocks a Get on a paused pool until Resume.
+func (p *Pool) waitResumed(resumed chan struct{}) error {
+	waitingClients.Inc()
+	defer waitingClients.Dec()
+	select {
+	case <-resumed:
+		return nil
+	case <-p.done:
+		return ErrPoolClosed
+	}
+}
+
+// Pause stops the pool from handing out connections: Get queues until
+// Resume, idle connections are closed and connections returned meanwhile are
+// closed rather than reused, so none survive a backend restart.
+func (p *Pool) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.resumed != nil {
+		return
+	}
+	p.resumed = make(chan struct{})
+	for _, c := range p.idle {
+		p.evictLocked(c.Conn, EvictPaused)
+	}
+	p.open -= len(p.idle)
+	p.idle = nil
+}
+
+// Resume lets a paused pool hand out connections again.
+func (p *Pool) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed == nil {
+		return
+	}
+	close(p.resumed)
+	p.resumed = nil
+	// waiters queued before the pause get the slots freed since
+	for len(p.waiters) > 0 && (p.cfg.MaxSize <= 0 || p.open < p.cfg.MaxSize) {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		p.open++
+		w.ch <- nil
+	}
+}
+
+// Paused reports whether the pool is paused.
+func (p *Pool) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+// dial opens a connection for a slot already counted in p.open.
+func (p *Pool) dial() (net.Conn, error) {
 	maxRetries := 3
 	var lastErr error
 	for i := 0; i < maxRetries; i++ {
-		select {
-		case pooled := <-p.connections:
-			if !p.isConnAlive(pooled.Conn) {
-				pooled.Conn.Close()
-				conn, err := p.createConn()
-				if err == nil {
-					return conn, nil
-				}
-				lastErr = err
-			} else {
-				pooled.lastUsed = time.Now()
-				return pooled.Conn, nil
-			}
-		default:
-			conn, err := p.createConn()
-			if err == nil {
-				return conn, nil
-			}
-			lastErr = err
+		conn, err := p.createConn()
+		if err == nil {
+			return conn, nil
 		}
+		lastErr = err
 		if i < maxRetries-1 {
 			time.Sleep(100 * time.Millisecond)
 		}
 	}
+	p.release()
 	return nil, fmt.Errorf("failed to get connection after %d retries: %w", maxRetries, lastErr)
 }
 
+// release gives up one open slot, passing it on to the first waiter if any.
+func (p *Pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.waiters) > 0 && !p.closed && p.resumed == nil && !p.overSizeLocked() {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		w.ch <- nil
+		return
+	}
+	p.open--
+}
+
 func (p *Pool) Put(conn net.Conn) {
 	if conn == nil {
 		return
 	}
+	p.inUse.Add(-1)
 
+	p.putIdle(conn)
+}
+
+// Discard closes a connection handed out by Get that must not be reused,
+// such as one closed under a killed session, and frees its slot.
+func (p *Pool) Discard(conn net.Conn) {
+	if conn == nil {
+		return
+	}
+	p.inUse.Add(-1)
+	p.mu.Lock()
+	p.closeLocked(conn)
+	p.mu.Unlock()
+	p.release()
+}
+
+// putIdle hands conn to the first waiter or keeps it idle, closing it
+// instead if the pool is closed, the connection is past its lifetime or
+// MaxIdle is reached.
+func (p *Pool) putIdle(conn net.Conn) {
 	pooled := &PooledConn{Conn: conn, lastUsed: time.Now()}
 
-	select {
-	case p.connections <- pooled:
-	default:
-		conn.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pooled.started = p.started[conn]
+	if p.closed {
+		p.open--
+		p.closeLocked(conn)
+		return
+	}
+	if p.resumed != nil {
+		p.open--
+		p.evictLocked(conn, EvictPaused)
+		return
+	}
+	if p.overSizeLocked() {
+		p.open--
+		p.evictLocked(conn, EvictResized)
+		return
+	}
+	if p.expiredLocked(conn, pooled.lastUsed) {
+		p.evictLocked(conn, EvictMaxLifetime)
+		if len(p.waiters) > 0 {
+			// pass the freed slot on so the waiter dials a fresh connection
+			w := p.waiters[0]
+			p.waiters = p.waiters[1:]
+			w.ch <- nil
+			return
+		}
+		p.open--
+		return
+	}
+	if len(p.waiters) > 0 {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		w.ch <- pooled
+		return
+	}
+	if p.cfg.MaxIdle > 0 && len(p.idle) >= p.cfg.MaxIdle {
+		p.open--
+		p.evictLocked(conn, EvictMaxIdle)
+		return
 	}
+	p.idle = append(p.idle, pooled)
 }
 
 func (p *Pool) Close() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	close(p.connections)
-	for c := range p.connections {
-		c.Conn.Close()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+	for _, w := range p.waiters {
+		close(w.ch)
+	}
+	p.waiters = nil
+	for _, c := range p.idle {
+		p.closeLocked(c.Conn)
 	}
+	p.open -= len(p.idle)
+	p.idle = nil
 }
 
-func (p *Pool) isConnAlive(conn net.Conn) bool {
-	if conn == nil {
-		return false
+// Healthy reports whether the backend looks usable: the last dial succeeded
+// and outlier detection has not ejected it. A pool that has not dialed yet
+// counts as healthy.
+func (p *Pool) Healthy() bool {
+	return !p.dialFailing.Load() && !p.Ejected()
+}
+
+// Check verifies that the backend is reachable. Unless the last dial
+// failed, it succeeds straight away when the pool holds open connections;
+// otherwise it dials one, which is kept idle for later use.
+func (p *Pool) Check() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	if p.resumed != nil {
+		// the backend is expected to be down for maintenance; requests
+		// queue until Resume instead of failing
+		p.mu.Unlock()
+		return nil
+	}
+	connected := !p.dialFailing.Load() && (len(p.idle) > 0 || p.inUse.Load() > 0)
+	if connected || (p.cfg.MaxSize > 0 && p.open >= p.cfg.MaxSize) {
+		p.mu.Unlock()
+		return nil
+	}
+	p.open++
+	p.mu.Unlock()
+
+	conn, err := p.createConn()
+	if err != nil {
+		p.release()
+		return err
 	}
-	// i set here deadline for reading tcp content if i get any data without err i remove the deadline
-	_ = conn.SetReadDeadline(time.Now().Add(1 * time.Millisecond))
-	var b [1]byte
-	_, err := conn.Read(b[:0])
-	conn.SetReadDeadline(time.Time{})
-	if err != nil && !errors.Is(err, net.ErrClosed) {
+	p.putIdle(conn)
+	return nil
+}
+
+// MarkStarted records that conn completed the startup handshake with the
+// backend, which makes it safe to ping, see Config.PingIdleThreshold.
+func (p *Pool) MarkStarted(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started[conn] = true
+}
+
+// isConnAlive checks an idle connection before it is handed out: a socket
+// peek always, and a ping round trip when it completed startup and has been
+// idle long enough. A connection without startup would take the ping as a
+// malformed StartupMessage and be closed by the backend.
+func (p *Pool) isConnAlive(pooled *PooledConn, idleFor time.Duration) bool {
+	if pooled.Conn == nil || !peekAlive(pooled.Conn) {
 		return false
 	}
+	if threshold := p.config().PingIdleThreshold; pooled.started && threshold > 0 && idleFor > threshold {
+		return ping(pooled.Conn) == nil
+	}
 	return true
 }
 
-func (p *Pool) cleanupIdleConnections() {
-	ticker := time.NewTicker(30 * time.Second)
+// ping runs an empty simple query and waits for ReadyForQuery.
+func ping(conn net.Conn) error {
+	_ = conn.SetDeadline(time.Now().Add(pingTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write([]byte{config.QueryMessage, 0, 0, 0, 5, 0}); err != nil {
+		return err
+	}
+	var header [5]byte
+	for {
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return err
+		}
+		length := int32(binary.BigEndian.Uint32(header[1:5]))
+		if length < 4 {
+			return fmt.Errorf("invalid message length %d", length)
+		}
+		if _, err := io.CopyN(io.Discard, conn, int64(length-4)); err != nil {
+			return err
+		}
+		switch header[0] {
+		case config.ErrorResponse:
+			return errors.New("ping failed with ErrorResponse")
+		case config.ReadyForQuery:
+			return nil
+		}
+	}
+}
+
+// maintain evicts idle connections past their idle timeout or lifetime and
+// dials new ones to keep MinIdle ready, until the pool is closed.
+func (p *Pool) maintain() {
+	ticker := time.NewTicker(maintenanceInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		n := len(p.connections)
-	Loop:
-		for i := 0; i < n; i++ {
-			select {
-			case pooled := <-p.connections:
-				if time.Since(pooled.lastUsed) > p.idleTimeout {
-					pooled.Conn.Close()
-				} else {
-					p.connections <- pooled
-				}
-			default:
-				break Loop
+	for {
+		p.evict(time.Now())
+		p.replenish()
+
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) evict(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	kept := p.idle[:0]
+	idle := len(p.idle)
+	// oldest first, so the idle timeout trims the least recently used
+	for _, pooled := range p.idle {
+		idleTooLong := p.cfg.IdleTimeout > 0 && now.Sub(pooled.lastUsed) > p.cfg.IdleTimeout && idle > p.cfg.MinIdle
+		if expired := p.expiredLocked(pooled.Conn, now); idleTooLong || expired {
+			reason := EvictIdleTimeout
+			if expired {
+				reason = EvictMaxLifetime
+			}
+			p.evictLocked(pooled.Conn, reason)
+			p.open--
+			idle--
+			continue
+		}
+		kept = append(kept, pooled)
+	}
+	clear(p.idle[len(kept):])
+	p.idle = kept
+}
+
+// replenish dials connections until MinIdle are idle or the pool is full.
+func (p *Pool) replenish() {
+	for {
+		p.mu.Lock()
+		if p.closed || p.resumed != nil || len(p.idle) >= p.cfg.MinIdle || (p.cfg.MaxSize > 0 && p.open >= p.cfg.MaxSize) {
+			p.mu.Unlock()
+			return
+		}
+		p.open++
+		p.mu.Unlock()
+
+		conn, err := p.createConn()
+		if err != nil {
+			p.mu.Lock()
+			logged := p.dialErr
+			p.dialErr = true
+			p.mu.Unlock()
+			if !logged {
+				slog.Warn("background dial failed", "backend", p.address, "err", err)
 			}
+			p.release()
+			return
 		}
+		p.mu.Lock()
+		p.dialErr = false
+		p.mu.Unlock()
+		p.putIdle(conn)
 	}
 }
@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -93,8 +94,370 @@ func TestPool_IdleCleanup(t *testing.T) {
 	conn, _ := p.Get()
 	p.Put(conn)
 
-	// Wait for cleanup ticker (30s is too long for unit test, but let's see if we can trigger it)
-	// Actually, p.cleanupIdleConnections uses a 30s ticker. I should probably make that configurable
-	// or just test that it works if I manually call it or something.
-	// For now, let's just verify basic Get/Put.
+	p.evict(time.Now().Add(200 * time.Millisecond))
+	p.mu.Lock()
+	idle, open := len(p.idle), p.open
+	p.mu.Unlock()
+	if idle != 0 || open != 0 {
+		t.Errorf("after idle timeout idle = %d, open = %d, want 0, 0", idle, open)
+	}
+}
+
+func startMockBackend(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	// keep accepted connections open so pooled conns stay alive
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPoolManager_GetROGroup(t *testing.T) {
+	primary := startMockBackend(t)
+	replica := startMockBackend(t)
+	analytics := startMockBackend(t)
+
+	pm := NewPoolManager(primary, []Node{{Address: replica}}, 2, 2, time.Minute)
+	defer pm.Close()
+	pm.AddGroup("analytics", []Node{{Address: analytics}}, 2, nil)
+
+	tests := []struct {
+		group string
+		addr  string
+	}{
+		{"analytics", analytics},
+		{DefaultGroup, replica},
+		{"unknown", replica},
+	}
+
+	for _, tt := range tests {
+		conn, p, err := pm.GetROGroup(tt.group, "")
+		if err != nil {
+			t.Fatalf("GetROGroup(%q) error = %v", tt.group, err)
+		}
+		if conn.RemoteAddr().String() != tt.addr {
+			t.Errorf("GetROGroup(%q) connected to %v, want %v", tt.group, conn.RemoteAddr(), tt.addr)
+		}
+		pm.PutRO(conn, p)
+	}
+}
+
+func TestPoolManager_GetROPreferred(t *testing.T) {
+	primary := startMockBackend(t)
+	a := startMockBackend(t)
+	b := startMockBackend(t)
+
+	pm := NewPoolManager(primary, []Node{{Address: a}, {Address: b}}, 2, 2, time.Minute)
+	defer pm.Close()
+
+	conn, sticky, err := pm.GetROGroup(DefaultGroup, "")
+	if err != nil {
+		t.Fatalf("GetROGroup() error = %v", err)
+	}
+	pm.PutRO(conn, sticky)
+
+	for i := 0; i < 4; i++ {
+		conn, p, err := pm.GetROPreferred(DefaultGroup, "", sticky)
+		if err != nil {
+			t.Fatalf("GetROPreferred() error = %v", err)
+		}
+		if p != sticky {
+			t.Errorf("GetROPreferred() moved from %s to %s", sticky.Address(), p.Address())
+		}
+		pm.PutRO(conn, p)
+	}
+
+	// an ejected replica is no longer preferred
+	sticky.health.mu.Lock()
+	sticky.health.ejectedUntil = time.Now().Add(time.Minute)
+	sticky.health.mu.Unlock()
+	conn, p, err := pm.GetROPreferred(DefaultGroup, "", sticky)
+	if err != nil {
+		t.Fatalf("GetROPreferred() error = %v", err)
+	}
+	if p == sticky {
+		t.Error("GetROPreferred() kept an ejected replica")
+	}
+	pm.PutRO(conn, p)
+}
+
+func TestPool_MaxSize(t *testing.T) {
+	addr := startMockBackend(t)
+	p := NewPoolWithConfig(addr, Config{MaxSize: 2, IdleTimeout: time.Minute, AcquireTimeout: 100 * time.Millisecond})
+	defer p.Close()
+
+	c1, err := p.Get()
+	if err != nil {
+		t.Fatalf("Pool.Get() error = %v", err)
+	}
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Pool.Get() error = %v", err)
+	}
+
+	start := time.Now()
+	_, err = p.Get()
+	if !errors.Is(err, ErrAcquireTimeout) {
+		t.Fatalf("Pool.Get() on full pool error = %v, want %v", err, ErrAcquireTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Pool.Get() gave up after %v, before the acquire timeout", elapsed)
+	}
+
+	p.Put(c1)
+	p.Put(c2)
+	p.mu.Lock()
+	open := p.open
+	p.mu.Unlock()
+	if open != 2 {
+		t.Errorf("open connections = %d, want 2", open)
+	}
+}
+
+func TestPool_WaitQueueFIFO(t *testing.T) {
+	addr := startMockBackend(t)
+	p := NewPoolWithConfig(addr, Config{MaxSize: 1, IdleTimeout: time.Minute, AcquireTimeout: time.Second})
+	defer p.Close()
+
+	held, err := p.Get()
+	if err != nil {
+		t.Fatalf("Pool.Get() error = %v", err)
+	}
+
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			conn, err := p.Get()
+			if err != nil {
+				t.Errorf("waiter %d: Pool.Get() error = %v", i, err)
+				return
+			}
+			order <- i
+			p.Put(conn)
+		}(i)
+		// make sure waiters queue in order
+		for {
+			p.mu.Lock()
+			n := len(p.waiters)
+			p.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	p.Put(held)
+	if first, second := <-order, <-order; first != 0 || second != 1 {
+		t.Errorf("waiters served in order %d, %d, want 0, 1", first, second)
+	}
+}
+
+func TestPool_CloseWakesWaiters(t *testing.T) {
+	addr := startMockBackend(t)
+	p := NewPoolWithConfig(addr, Config{MaxSize: 1, IdleTimeout: time.Minute, AcquireTimeout: time.Minute})
+
+	if _, err := p.Get(); err != nil {
+		t.Fatalf("Pool.Get() error = %v", err)
+	}
+	errc := make(chan error)
+	go func() {
+		_, err := p.Get()
+		errc <- err
+	}()
+	for {
+		p.mu.Lock()
+		n := len(p.waiters)
+		p.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	p.Close()
+	if err := <-errc; !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("waiting Pool.Get() error = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestPool_MinIdleWarmup(t *testing.T) {
+	addr := startMockBackend(t)
+	p := NewPoolWithConfig(addr, Config{MaxSize: 5, MinIdle: 3, IdleTimeout: time.Millisecond})
+	defer p.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.Lock()
+		idle := len(p.idle)
+		p.mu.Unlock()
+		if idle == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("warmup reached %d idle connections, want 3", idle)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the idle timeout never trims below MinIdle
+	p.evict(time.Now().Add(time.Minute))
+	p.mu.Lock()
+	idle := len(p.idle)
+	p.mu.Unlock()
+	if idle != 3 {
+		t.Errorf("after eviction idle = %d, want 3", idle)
+	}
+}
+
+func TestPool_WarmupDoesNotBlock(t *testing.T) {
+	start := time.Now()
+	p := NewPoolWithConfig("127.0.0.1:1", Config{MaxSize: 5, MinIdle: 5})
+	defer p.Close()
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("NewPoolWithConfig() blocked for %v on an unreachable backend", elapsed)
+	}
+}
+
+func TestPool_MaxLifetimeAndMaxIdle(t *testing.T) {
+	addr := startMockBackend(t)
+	p := NewPoolWithConfig(addr, Config{MaxSize: 5, MaxIdle: 1, MaxLifetime: time.Hour})
+	defer p.Close()
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	p.Put(c1)
+	p.Put(c2)
+
+	p.mu.Lock()
+	idle, open := len(p.idle), p.open
+	p.mu.Unlock()
+	if idle != 1 || open != 1 {
+		t.Errorf("with MaxIdle 1 idle = %d, open = %d, want 1, 1", idle, open)
+	}
+
+	p.evict(time.Now().Add(2 * time.Hour))
+	p.mu.Lock()
+	idle, open = len(p.idle), p.open
+	p.mu.Unlock()
+	if idle != 0 || open != 0 {
+		t.Errorf("after MaxLifetime idle = %d, open = %d, want 0, 0", idle, open)
+	}
+}
+
+func TestPool_Check(t *testing.T) {
+	p := NewPoolWithConfig(startMockBackend(t), Config{MaxSize: 2})
+	defer p.Close()
+	if err := p.Check(); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if st := p.Stats(); st.Idle != 1 || !st.Healthy {
+		t.Errorf("after Check() idle = %d, healthy = %v, want 1, true", st.Idle, st.Healthy)
+	}
+
+	down := NewPoolWithConfig("127.0.0.1:1", Config{MaxSize: 2})
+	defer down.Close()
+	if err := down.Check(); err == nil {
+		t.Error("Check() on an unreachable backend succeeded")
+	}
+	if st := down.Stats(); st.Open != 0 || st.Healthy {
+		t.Errorf("after failed Check() open = %d, healthy = %v, want 0, false", st.Open, st.Healthy)
+	}
+}
+
+func TestPool_PauseResume(t *testing.T) {
+	p := NewPoolWithConfig(startMockBackend(t), Config{MaxSize: 2})
+	defer p.Close()
+
+	held, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	idle, _ := p.Get()
+	p.Put(idle)
+
+	p.Pause()
+	if st := p.Stats(); !st.Paused || st.Idle != 0 || st.Evictions[EvictPaused] != 1 {
+		t.Errorf("after Pause() paused/idle/evicted = %v/%d/%d, want true/0/1", st.Paused, st.Idle, st.Evictions[EvictPaused])
+	}
+
+	got := make(chan error, 1)
+	go func() {
+		conn, err := p.Get()
+		if err == nil {
+			p.Put(conn)
+		}
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		t.Fatalf("Get() on a paused pool returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// connections returned while paused are not reused
+	p.Put(held)
+	if st := p.Stats(); st.Open != 0 || st.Evictions[EvictPaused] != 2 {
+		t.Errorf("after Put() while paused open/evicted = %d/%d, want 0/2", st.Open, st.Evictions[EvictPaused])
+	}
+
+	p.Resume()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Errorf("Get() after Resume() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get() still blocked after Resume()")
+	}
+}
+
+func TestPool_SetConfig(t *testing.T) {
+	addr := startMockBackend(t)
+	p := NewPoolWithConfig(addr, Config{MaxSize: 3, IdleTimeout: time.Minute, AcquireTimeout: 100 * time.Millisecond})
+	defer p.Close()
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		c, err := p.Get()
+		if err != nil {
+			t.Fatalf("Pool.Get() error = %v", err)
+		}
+		conns = append(conns, c)
+	}
+	p.Put(conns[0])
+	p.SetConfig(Config{MaxSize: 1, IdleTimeout: time.Minute, AcquireTimeout: 100 * time.Millisecond})
+	p.Put(conns[1])
+	p.Put(conns[2])
+
+	st := p.Stats()
+	if st.Open != 1 || st.Evictions[EvictResized] != 2 {
+		t.Errorf("after shrinking open = %d, resized evictions = %d, want 1 and 2", st.Open, st.Evictions[EvictResized])
+	}
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("Pool.Get() error = %v", err)
+	}
+	if _, err := p.Get(); !errors.Is(err, ErrAcquireTimeout) {
+		t.Errorf("Pool.Get() over the new size error = %v, want %v", err, ErrAcquireTimeout)
+	}
+	p.Put(c)
 }
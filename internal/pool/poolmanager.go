@@ -1,30 +1,193 @@
-
 package pool
 
 import (
 	"net"
+	"slices"
 	"sync"
 	"time"
 )
 
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+// DefaultGroup names the replicas listed directly under backend.replicas.
+const DefaultGroup = ""
+
+// Node describes one replica of a group.
+type Node struct {
+	Address string
+	Weight  int
+}
+
+type replicaGroup struct {
+	pools     []*Pool
+	size      int // MaxSize of each pool
+	balancer  Balancer
+	lastCheck time.Time // last outlier detection pass
+}
+
+// available returns the pools not draining and not ejected by outlier
+// detection, or all pools not draining if every one of them is ejected.
+func (g *replicaGroup) available() []*Pool {
+	out := make([]*Pool, 0, len(g.pools))
+	active := 0
+	for _, p := range g.pools {
+		if p.Draining() {
+			continue
+		}
+		active++
+		if !p.Ejected() {
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 && active > 0 {
+		for _, p := range g.pools {
+			if !p.Draining() {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
 type PoolManager struct {
-	RWPool *Pool     // primary
-	ROPool []*Pool   // replicas
-	nextRO int
-	mu     sync.Mutex
+	RWPool   *Pool // primary
+	groups   map[string]*replicaGroup
+	roConfig Config // template for replica pools, MaxSize set per group
+	outlier  OutlierConfig
+	paused   bool
+	mu       sync.Mutex
+
+	drainTimeout time.Duration // see SetDrainTimeout
+	onRetire     func(*Pool)   // see OnRetire
 }
 
 // NewPoolManager initializes primary + replicas
-func NewPoolManager(primaryAddr string, replicaAddrs []string, rwSize, roSize int, idleTimeout time.Duration) *PoolManager {
+func NewPoolManager(primaryAddr string, replicas []Node, rwSize, roSize int, idleTimeout time.Duration) *PoolManager {
+	return NewPoolManagerWithConfig(primaryAddr, replicas,
+		Config{MaxSize: rwSize, IdleTimeout: idleTimeout},
+		Config{MaxSize: roSize, IdleTimeout: idleTimeout},
+	)
+}
+
+// NewPoolManagerWithConfig initializes primary + replicas with full pool
+// settings. roCfg also applies to groups added later.
+func NewPoolManagerWithConfig(primaryAddr string, replicas []Node, rwCfg, roCfg Config) *PoolManager {
+	rwCfg.Role = RolePrimary
+	roCfg.Role = RoleReplica
 	pm := &PoolManager{
-		RWPool: NewPool(primaryAddr, rwSize, idleTimeout),
+		RWPool:   NewPoolWithConfig(primaryAddr, rwCfg),
+		groups:   make(map[string]*replicaGroup),
+		roConfig: roCfg,
+		outlier:  DefaultOutlierConfig(),
 	}
+	pm.AddGroup(DefaultGroup, replicas, roCfg.MaxSize, nil)
+	return pm
+}
 
-	for _, addr := range replicaAddrs {
-		pm.ROPool = append(pm.ROPool, NewPool(addr, roSize, idleTimeout))
+// AddGroup creates pools for a named replica group. A nil balancer selects
+// weighted round-robin.
+func (pm *PoolManager) AddGroup(name string, nodes []Node, size int, b Balancer) {
+	if b == nil {
+		b = &weightedRoundRobin{}
 	}
+	g := &replicaGroup{balancer: b, size: size}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, n := range nodes {
+		g.pools = append(g.pools, pm.newReplicaPool(n, size))
+	}
+	pm.groups[name] = g
+}
 
-	return pm
+// SetGroup creates a replica group or updates an existing one to match
+// nodes. Pools of nodes already in the group are kept with their new weight
+// and size, new nodes get pools, and the pools of nodes no longer listed are
+// drained and closed in the background. A nil balancer selects weighted
+// round-robin.
+func (pm *PoolManager) SetGroup(name string, nodes []Node, size int, b Balancer) {
+	if b == nil {
+		b = &weightedRoundRobin{}
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	g, ok := pm.groups[name]
+	if !ok {
+		g = &replicaGroup{}
+		pm.groups[name] = g
+	}
+	cfg := pm.roConfig
+	cfg.MaxSize = size
+	var pools []*Pool
+	for _, n := range nodes {
+		i := slices.IndexFunc(g.pools, func(p *Pool) bool { return p.address == n.Address })
+		if i < 0 {
+			pools = append(pools, pm.newReplicaPool(n, size))
+			continue
+		}
+		p := g.pools[i]
+		g.pools = slices.Delete(g.pools, i, i+1)
+		p.setWeight(n.Weight)
+		p.SetConfig(cfg)
+		pools = append(pools, p)
+	}
+	pm.retire(g.pools)
+	g.pools, g.size, g.balancer = pools, size, b
+}
+
+// RemoveGroup drains and closes the pools of a replica group and deletes
+// it. The default group is emptied instead.
+func (pm *PoolManager) RemoveGroup(name string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	g, ok := pm.groups[name]
+	if !ok {
+		return
+	}
+	pm.retire(g.pools)
+	g.pools = nil
+	if name != DefaultGroup {
+		delete(pm.groups, name)
+	}
+}
+
+// GroupNames lists the replica groups, default first.
+func (pm *PoolManager) GroupNames() []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.groupNames()
+}
+
+// SetConfig changes the settings of the primary pool and of every replica
+// pool, which keep the MaxSize of their group. roCfg also applies to pools
+// created later.
+func (pm *PoolManager) SetConfig(rwCfg, roCfg Config) {
+	pm.RWPool.SetConfig(rwCfg)
+	roCfg.Role = RoleReplica
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.roConfig = roCfg
+	for _, g := range pm.groups {
+		cfg := roCfg
+		cfg.MaxSize = g.size
+		for _, p := range g.pools {
+			p.SetConfig(cfg)
+		}
+	}
+}
+
+// newReplicaPool creates the pool of a replica node. Called with pm.mu held.
+func (pm *PoolManager) newReplicaPool(n Node, size int) *Pool {
+	cfg := pm.roConfig
+	cfg.MaxSize = size
+	p := NewPoolWithConfig(n.Address, cfg)
+	p.setWeight(n.Weight)
+	if pm.paused {
+		p.Pause()
+	}
+	return p
 }
 
 // GetRW returns a primary (read/write) connection
@@ -37,33 +200,140 @@ func (pm *PoolManager) PutRW(conn net.Conn) {
 	pm.RWPool.Put(conn)
 }
 
-// GetRO returns a replica (read-only) connection using round-robin
-func (pm *PoolManager) GetRO() (net.Conn, *Pool, error) {
+// DiscardRW closes a primary connection instead of returning it, see
+// Pool.Discard.
+func (pm *PoolManager) DiscardRW(conn net.Conn) {
+	pm.RWPool.Discard(conn)
+}
+
+// SetBalancer changes the load-balancing strategy of an existing group.
+func (pm *PoolManager) SetBalancer(name string, b Balancer) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
+	if g, ok := pm.groups[name]; ok {
+		g.balancer = b
+	}
+}
+
+// SetOutlierDetection changes the thresholds used to eject slow or failing
+// replicas. Zero fields keep their defaults.
+func (pm *PoolManager) SetOutlierDetection(c OutlierConfig) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.outlier = c.withDefaults()
+}
+
+// GetRO returns a connection from the default replicas
+func (pm *PoolManager) GetRO() (net.Conn, *Pool, error) {
+	return pm.GetROGroup(DefaultGroup, "")
+}
+
+// GetROGroup returns a replica connection from the named group, chosen by the
+// group's balancer. key identifies the client for hash-based balancing.
+// Unknown or empty groups fall back to the default replicas, then to the
+// primary.
+func (pm *PoolManager) GetROGroup(name, key string) (net.Conn, *Pool, error) {
+	return pm.GetROPreferred(name, key, nil)
+}
 
-	if len(pm.ROPool) == 0 {
+// GetROPreferred is GetROGroup that reuses preferred as long as it is still a
+// healthy member of the group, so a client can stay on one replica.
+func (pm *PoolManager) GetROPreferred(name, key string, preferred *Pool) (net.Conn, *Pool, error) {
+	pm.mu.Lock()
+	g, ok := pm.groups[name]
+	if !ok || len(g.pools) == 0 {
+		g = pm.groups[DefaultGroup]
+	}
+	if g == nil || len(g.pools) == 0 {
+		pm.mu.Unlock()
 		// fallback to primary
 		conn, err := pm.RWPool.Get()
 		return conn, pm.RWPool, err
 	}
 
-	pool := pm.ROPool[pm.nextRO]
-	pm.nextRO = (pm.nextRO + 1) % len(pm.ROPool)
+	if now := time.Now(); now.Sub(g.lastCheck) >= pm.outlier.Interval {
+		g.lastCheck = now
+		pm.outlier.detectOutliers(g.pools, now)
+	}
+	available := g.available()
+	if len(available) == 0 {
+		// every replica is draining
+		pm.mu.Unlock()
+		conn, err := pm.RWPool.Get()
+		return conn, pm.RWPool, err
+	}
+	if preferred != nil && slices.Contains(available, preferred) && !preferred.Ejected() {
+		pm.mu.Unlock()
+		if conn, err := preferred.Get(); err == nil {
+			return conn, preferred, nil
+		}
+		pm.mu.Lock()
+	}
+	pool := g.balancer.Pick(available, key)
+	pm.mu.Unlock()
 
 	conn, err := pool.Get()
 	return conn, pool, err
 }
 
+// groupNames returns the group names in a stable order, default first.
+// Called with pm.mu held.
+func (pm *PoolManager) groupNames() []string {
+	names := make([]string, 0, len(pm.groups))
+	for name := range pm.groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
 // PutRO returns a replica connection to the pool
 func (pm *PoolManager) PutRO(conn net.Conn, pool *Pool) {
 	pool.Put(conn)
 }
 
+// DiscardRO closes a replica connection instead of returning it, see
+// Pool.Discard.
+func (pm *PoolManager) DiscardRO(conn net.Conn, pool *Pool) {
+	if pool != nil {
+		pool.Discard(conn)
+	}
+}
+
+// Pause stops every pool from handing out connections until Resume, see
+// Pool.Pause.
+func (pm *PoolManager) Pause() {
+	pm.mu.Lock()
+	pm.paused = true
+	pm.mu.Unlock()
+	for _, n := range pm.nodes() {
+		n.pool.Pause()
+	}
+}
+
+func (pm *PoolManager) Resume() {
+	pm.mu.Lock()
+	pm.paused = false
+	pm.mu.Unlock()
+	for _, n := range pm.nodes() {
+		n.pool.Resume()
+	}
+}
+
+func (pm *PoolManager) Paused() bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.paused
+}
+
 // Close shuts down all pools
 func (pm *PoolManager) Close() {
 	pm.RWPool.Close()
-	for _, p := range pm.ROPool {
-		p.Close()
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, g := range pm.groups {
+		for _, p := range g.pools {
+			p.Close()
+		}
 	}
-}
\ No newline at end of file
+}
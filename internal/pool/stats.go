@@ -0,0 +1,176 @@
+package pool
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/pggate/internal/metrics"
+)
+
+// Reasons a pooled connection was closed by the pool itself.
+const (
+	EvictIdleTimeout = "idle_timeout"
+	EvictMaxLifetime = "max_lifetime"
+	EvictMaxIdle     = "max_idle"
+	EvictStale       = "stale"
+	EvictPaused      = "paused"
+	EvictResized     = "resized"
+)
+
+var evictReasons = []string{EvictIdleTimeout, EvictMaxLifetime, EvictMaxIdle, EvictStale, EvictPaused, EvictResized}
+
+// counters are the cumulative totals behind Stats.
+type counters struct {
+	acquired     atomic.Int64
+	acquireNanos atomic.Int64 // time spent in successful Get calls
+	dialed       atomic.Int64
+	dialFailures atomic.Int64
+	evictions    [6]atomic.Int64 // indexed like evictReasons
+	dialLatency  *metrics.Histogram
+}
+
+// Stats is a point-in-time snapshot of a pool.
+type Stats struct {
+	Address string `json:"address"`
+	Role    string `json:"role"` // primary or replica
+	Weight  int    `json:"weight"`
+
+	Open    int `json:"open"`
+	Idle    int `json:"idle"`
+	InUse   int `json:"in_use"`
+	Waiters int `json:"waiters"`
+
+	Acquired       int64            `json:"acquired"`
+	Dialed         int64            `json:"dialed"`
+	DialFailures   int64            `json:"dial_failures"`
+	AcquireWait    time.Duration    `json:"acquire_wait_ns"` // total across all acquisitions
+	AvgAcquireWait time.Duration    `json:"avg_acquire_wait_ns"`
+	Evictions      map[string]int64 `json:"evictions"`
+
+	Latency   time.Duration `json:"latency_ns"`
+	ErrorRate float64       `json:"error_rate"`
+	Ejected   bool          `json:"ejected"`
+	Healthy   bool          `json:"healthy"`
+	Draining  bool          `json:"draining"`
+	Paused    bool          `json:"paused"`
+}
+
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	st := Stats{
+		Address: p.address,
+		Role:    p.role,
+		Weight:  p.Weight(),
+		Open:    p.open,
+		Idle:    len(p.idle),
+		Waiters: len(p.waiters),
+		Paused:  p.resumed != nil,
+	}
+	p.mu.Unlock()
+
+	st.InUse = int(p.inUse.Load())
+	st.Acquired = p.stats.acquired.Load()
+	st.Dialed = p.stats.dialed.Load()
+	st.DialFailures = p.stats.dialFailures.Load()
+	st.AcquireWait = time.Duration(p.stats.acquireNanos.Load())
+	if st.Acquired > 0 {
+		st.AvgAcquireWait = st.AcquireWait / time.Duration(st.Acquired)
+	}
+	st.Evictions = make(map[string]int64, len(evictReasons))
+	for i, reason := range evictReasons {
+		st.Evictions[reason] = p.stats.evictions[i].Load()
+	}
+	st.Latency = p.Latency()
+	st.ErrorRate = p.ErrorRate()
+	st.Ejected = p.Ejected()
+	st.Healthy = p.Healthy()
+	st.Draining = p.Draining()
+	return st
+}
+
+// evictLocked closes a pool-owned connection and counts why. Called with
+// p.mu held.
+func (p *Pool) evictLocked(conn net.Conn, reason string) {
+	for i, r := range evictReasons {
+		if r == reason {
+			p.stats.evictions[i].Add(1)
+		}
+	}
+	p.closeLocked(conn)
+}
+
+// NodeStats is the Stats of one backend node with its replica group.
+type NodeStats struct {
+	Group string `json:"group,omitempty"` // empty for the primary and the default replicas
+	Stats
+}
+
+type node struct {
+	group string
+	pool  *Pool
+}
+
+// nodes lists every pool, primary first, then replicas by group.
+func (pm *PoolManager) nodes() []node {
+	out := []node{{pool: pm.RWPool}}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, name := range pm.groupNames() {
+		for _, p := range pm.groups[name].pools {
+			out = append(out, node{group: name, pool: p})
+		}
+	}
+	return out
+}
+
+// Stats returns a snapshot of every pool, primary first, then replicas by
+// group.
+func (pm *PoolManager) Stats() []NodeStats {
+	nodes := pm.nodes()
+	out := make([]NodeStats, len(nodes))
+	for i, n := range nodes {
+		out[i] = NodeStats{Group: n.group, Stats: n.pool.Stats()}
+	}
+	return out
+}
+
+// Collect implements metrics.Collector with per-node pool metrics.
+func (pm *PoolManager) Collect() []metrics.Family {
+	conns := metrics.Family{Name: "pggate_pool_connections", Help: "Backend connections per pool by state", Type: metrics.GaugeType}
+	dial := metrics.Family{Name: "pggate_pool_dial_duration_seconds", Help: "Time to establish backend TCP connections per pool", Type: metrics.HistogramType}
+	waiters := metrics.Family{Name: "pggate_pool_waiters", Help: "Requests currently queued per pool", Type: metrics.GaugeType}
+	acquired := metrics.Family{Name: "pggate_pool_acquired_total", Help: "Connections handed out per pool", Type: metrics.CounterType}
+	acquireTime := metrics.Family{Name: "pggate_pool_acquire_seconds_total", Help: "Time spent acquiring connections per pool", Type: metrics.CounterType}
+	dialed := metrics.Family{Name: "pggate_pool_dialed_total", Help: "Backend connections opened per pool", Type: metrics.CounterType}
+	dialFailures := metrics.Family{Name: "pggate_pool_dial_failures_total", Help: "Failed backend dials per pool", Type: metrics.CounterType}
+	evictions := metrics.Family{Name: "pggate_pool_evictions_total", Help: "Connections closed by the pool per reason", Type: metrics.CounterType}
+
+	for _, n := range pm.nodes() {
+		s := n.pool.Stats()
+		labels := []metrics.Label{{Name: "backend", Value: s.Address}, {Name: "role", Value: s.Role}, {Name: "group", Value: n.group}}
+		with := func(name, value string) []metrics.Label {
+			return append(labels[:len(labels):len(labels)], metrics.Label{Name: name, Value: value})
+		}
+
+		// open also counts slots being dialed
+		dialing := max(s.Open-s.Idle-s.InUse, 0)
+		conns.Series = append(conns.Series,
+			metrics.Series{Labels: with("state", "idle"), Value: float64(s.Idle)},
+			metrics.Series{Labels: with("state", "in_use"), Value: float64(s.InUse)},
+			metrics.Series{Labels: with("state", "dialing"), Value: float64(dialing)})
+		if h := n.pool.stats.dialLatency; h != nil {
+			snap := h.Snapshot()
+			dial.Series = append(dial.Series, metrics.Series{Labels: labels, Histogram: &snap})
+		}
+		waiters.Series = append(waiters.Series, metrics.Series{Labels: labels, Value: float64(s.Waiters)})
+		acquired.Series = append(acquired.Series, metrics.Series{Labels: labels, Value: float64(s.Acquired)})
+		acquireTime.Series = append(acquireTime.Series, metrics.Series{Labels: labels, Value: s.AcquireWait.Seconds()})
+		dialed.Series = append(dialed.Series, metrics.Series{Labels: labels, Value: float64(s.Dialed)})
+		dialFailures.Series = append(dialFailures.Series, metrics.Series{Labels: labels, Value: float64(s.DialFailures)})
+		for _, reason := range evictReasons {
+			evictions.Series = append(evictions.Series, metrics.Series{Labels: with("reason", reason), Value: float64(s.Evictions[reason])})
+		}
+	}
+	return []metrics.Family{conns, dial, waiters, acquired, acquireTime, dialed, dialFailures, evictions}
+}
@@ -0,0 +1,80 @@
+package pool
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/metrics"
+)
+
+func TestPool_Stats(t *testing.T) {
+	addr := startMockBackend(t)
+	p := NewPoolWithConfig(addr, Config{MaxSize: 3, MaxIdle: 1})
+	defer p.Close()
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	st := p.Stats()
+	if st.Open != 2 || st.InUse != 2 || st.Idle != 0 {
+		t.Errorf("Stats() open/in_use/idle = %d/%d/%d, want 2/2/0", st.Open, st.InUse, st.Idle)
+	}
+	if st.Acquired != 2 || st.Dialed != 2 {
+		t.Errorf("Stats() acquired/dialed = %d/%d, want 2/2", st.Acquired, st.Dialed)
+	}
+
+	p.Put(c1)
+	p.Put(c2) // over MaxIdle
+	st = p.Stats()
+	if st.Open != 1 || st.Idle != 1 || st.InUse != 0 {
+		t.Errorf("Stats() open/in_use/idle = %d/%d/%d, want 1/0/1", st.Open, st.InUse, st.Idle)
+	}
+	if st.Evictions[EvictMaxIdle] != 1 {
+		t.Errorf("Stats() evictions[%s] = %d, want 1", EvictMaxIdle, st.Evictions[EvictMaxIdle])
+	}
+	if st.AvgAcquireWait <= 0 || st.AvgAcquireWait > st.AcquireWait {
+		t.Errorf("Stats() avg acquire wait = %v with total %v", st.AvgAcquireWait, st.AcquireWait)
+	}
+}
+
+func TestPool_StatsDialFailures(t *testing.T) {
+	p := NewPoolWithConfig("127.0.0.1:1", Config{MaxSize: 1})
+	defer p.Close()
+
+	p.Get()
+	if st := p.Stats(); st.DialFailures < 3 || st.Open != 0 {
+		t.Errorf("Stats() dial failures = %d, open = %d, want >= 3, 0", st.DialFailures, st.Open)
+	}
+}
+
+func TestPoolManager_StatsAndMetrics(t *testing.T) {
+	primary := startMockBackend(t)
+	replica := startMockBackend(t)
+	pm := NewPoolManager(primary, []Node{{Address: replica}}, 2, 2, time.Minute)
+	defer pm.Close()
+	pm.AddGroup("analytics", []Node{{Address: replica, Weight: 2}}, 1, nil)
+
+	stats := pm.Stats()
+	if len(stats) != 3 {
+		t.Fatalf("len(Stats()) = %d, want 3", len(stats))
+	}
+	if stats[0].Role != "primary" || stats[1].Group != DefaultGroup || stats[2].Group != "analytics" {
+		t.Errorf("Stats() order = %s/%q, %s/%q, %s/%q", stats[0].Role, stats[0].Group,
+			stats[1].Role, stats[1].Group, stats[2].Role, stats[2].Group)
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WriteText(&buf, pm.Collect()); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	for _, want := range []string{
+		`pggate_pool_connections{backend="` + replica + `",role="replica",group="analytics",state="idle"} 0`,
+		`pggate_pool_connections{backend="` + primary + `",role="primary",group="",state="in_use"} 0`,
+		`pggate_pool_dial_duration_seconds_count{backend="` + primary + `",role="primary",group=""}`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Collect() missing %q in:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/pool"
+)
+
+const (
+	// DefaultAdminDatabase is the virtual database of the admin console.
+	DefaultAdminDatabase = "pggate"
+	DefaultPauseTimeout  = time.Minute
+)
+
+// AdminConfig enables the admin console: clients connecting to Database are
+// served by PgGate itself, PgBouncer style, instead of being forwarded.
+type AdminConfig struct {
+	Database string   // defaults to DefaultAdminDatabase
+	Users    []string // users allowed in; empty disables the console
+	// Password is the cleartext password of the console, required when set.
+	// Without one, the commands that change state are refused.
+	Password string
+	// HTTPToken is the bearer token of the admin API routes that change
+	// state; empty disables them.
+	HTTPToken string
+	// PauseTimeout bounds how long PAUSE waits for in-flight transactions;
+	// defaults to DefaultPauseTimeout.
+	PauseTimeout time.Duration
+	// DrainTimeout bounds how long DRAIN waits for a replica's connections
+	// to be returned; defaults to pool.DefaultDrainTimeout.
+	DrainTimeout time.Duration
+
+	// Reload applies the configuration file again and lists the changed
+	// settings that need a restart, see Proxy.Reload.
+	Reload func() (restart []string, err error)
+	// Settings lists the running configuration, for SHOW CONFIG.
+	Settings func() ([]config.Setting, error)
+}
+
+func (c AdminConfig) database() string {
+	if c.Database == "" {
+		return DefaultAdminDatabase
+	}
+	return c.Database
+}
+
+func (c AdminConfig) pauseTimeout() time.Duration {
+	if c.PauseTimeout <= 0 {
+		return DefaultPauseTimeout
+	}
+	return c.PauseTimeout
+}
+
+func (c AdminConfig) drainTimeout() time.Duration {
+	if c.DrainTimeout <= 0 {
+		return pool.DefaultDrainTimeout
+	}
+	return c.DrainTimeout
+}
+
+// ErrReloadUnavailable is returned by Reload when no reload function is
+// configured.
+var ErrReloadUnavailable = errors.New("reload is not available")
+
+// Reload applies the configuration file again through AdminConfig.Reload.
+func (p *Proxy) Reload() ([]string, error) {
+	reload := p.config().Admin.Reload
+	if reload == nil {
+		return nil, ErrReloadUnavailable
+	}
+	return reload()
+}
+
+// HTTPToken is the configured admin API token, see AdminConfig.
+func (p *Proxy) HTTPToken() string {
+	return p.config().Admin.HTTPToken
+}
+
+// DrainTimeout is the configured bound on draining a replica, see
+// AdminConfig.
+func (p *Proxy) DrainTimeout() time.Duration {
+	return p.config().Admin.drainTimeout()
+}
+
+// isConsole reports whether a StartupMessage asks for the admin console.
+func (p *Proxy) isConsole(params map[string]string) bool {
+	admin := p.config().Admin
+	if len(admin.Users) == 0 {
+		return false
+	}
+	db := params["database"]
+	if db == "" {
+		db = params["user"]
+	}
+	return db == admin.database()
+}
+
+// console serves one admin connection. Only the simple query protocol is
+// supported, which is what psql uses.
+type console struct {
+	proxy *Proxy
+	conn  net.Conn
+	user  string
+	log   *slog.Logger
+}
+
+func (p *Proxy) serveConsole(conn net.Conn, params map[string]string) {
+	c := &console{
+		proxy: p,
+		conn:  conn,
+		user:  params["user"],
+		log:   slog.With("client_addr", conn.RemoteAddr().String(), "user", params["user"], "console", true),
+	}
+	if err := c.authenticate(); err != nil {
+		c.log.Warn("admin console authentication failed", "err", err)
+		return
+	}
+	c.log.Info("admin console session started")
+	if err := c.run(); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		c.log.Warn("admin console session ended", "err", err)
+	}
+}
+
+func (c *console) authenticate() error {
+	cfg := c.proxy.config().Admin
+	if !slices.Contains(cfg.Users, c.user) {
+		c.writeError("FATAL", "28000", fmt.Sprintf("user %q is not allowed to use the admin console", c.user))
+		return fmt.Errorf("user %q not allowed", c.user)
+	}
+	if cfg.Password != "" {
+		// AuthenticationCleartextPassword
+		if err := c.write(config.Authentification, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+			return err
+		}
+		typ, body, err := c.read()
+		if err != nil {
+			return err
+		}
+		password := strings.TrimRight(string(body), "\x00")
+		if typ != config.PasswordMessage || subtle.ConstantTimeCompare([]byte(password), []byte(cfg.Password)) != 1 {
+			c.writeError("FATAL", "28P01", fmt.Sprintf("password authentication failed for user %q", c.user))
+			return errors.New("wrong password")
+		}
+	}
+	if err := c.write(config.Authentification, binary.BigEndian.AppendUint32(nil, 0)); err != nil {
+		return err
+	}
+	for _, kv := range [][2]string{
+		{"server_version", "14.0 (PgGate)"},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		if err := c.write(config.ParameterStatus, cstrings(kv[0], kv[1])); err != nil {
+			return err
+		}
+	}
+	return c.ready()
+}
+
+func (c *console) run() error {
+	extendedErr := false
+	for {
+		typ, body, err := c.read()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case config.QueryMessage:
+			if err := c.query(strings.TrimRight(string(body), "\x00")); err != nil {
+				return err
+			}
+		case config.TerminateMessage:
+			return nil
+		case config.SyncMessage:
+			extendedErr = false
+			if err := c.ready(); err != nil {
+				return err
+			}
+		default:
+			// extended protocol: report once, then skip until Sync
+			if !extendedErr {
+				extendedErr = true
+				if err := c.writeError("ERROR", "0A000", "the admin console only supports the simple query protocol"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// controlCommands change the state of the proxy. Like the admin API routes
+// that change state, they are refused unless a credential is configured.
+var controlCommands = []string{"RELOAD", "PAUSE", "RESUME", "KILL", "DRAIN"}
+
+// query runs one admin command and finishes with ReadyForQuery.
+func (c *console) query(q string) error {
+	q = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(q), ";"))
+	if q == "" {
+		if err := c.write(config.EmptyQuery, nil); err != nil {
+			return err
+		}
+		return c.ready()
+	}
+	fields := strings.Fields(strings.ToUpper(q))
+	c.log.Info("admin command", "command", q)
+
+	var err error
+	switch {
+	case len(fields) == 2 && fields[0] == "SHOW":
+		err = c.show(fields[1])
+	case slices.Contains(controlCommands, fields[0]) && c.proxy.config().Admin.Password == "":
+		err = c.writeError("ERROR", "42501", fmt.Sprintf("%s is disabled, set admin.password to enable it", fields[0]))
+	case len(fields) == 1 && fields[0] == "RELOAD":
+		err = c.reload()
+	case len(fields) == 1 && fields[0] == "PAUSE":
+		err = c.pause()
+	case len(fields) == 1 && fields[0] == "RESUME":
+		c.proxy.Resume()
+		err = c.complete("RESUME")
+	case len(fields) == 2 && fields[0] == "KILL":
+		err = c.kill(fields[1])
+	case len(fields) == 2 && fields[0] == "DRAIN":
+		err = c.drain(strings.Fields(q)[1])
+	default:
+		err = c.writeError("ERROR", "42601", fmt.Sprintf("unknown admin command %q, try SHOW HELP", q))
+	}
+	if err != nil {
+		return err
+	}
+	return c.ready()
+}
+
+func (c *console) show(what string) error {
+	switch what {
+	case "HELP":
+		return c.rows([]string{"command", "description"}, [][]string{
+			{"SHOW POOLS", "connection pools per backend node"},
+			{"SHOW CLIENTS", "connected client sessions"},
+			{"SHOW SERVERS", "backend connections held by client sessions"},
+			{"SHOW STATS", "query statistics per user, database and application"},
+			{"SHOW QUERIES", "query statistics per normalized query"},
+			{"SHOW CONFIG", "running configuration"},
+			{"RELOAD", "reload the configuration file"},
+			{"PAUSE", "hold new queries and wait for transactions to finish"},
+			{"RESUME", "release the queries held by PAUSE"},
+			{"KILL <client id>", "disconnect a client session"},
+			{"DRAIN <backend>", "take a replica out of rotation, wait for its connections and remove it"},
+		})
+	case "POOLS":
+		var rows [][]string
+		for _, s := range c.proxy.poolManager.Stats() {
+			rows = append(rows, []string{
+				s.Group, s.Address, s.Role, itoa(s.Open), itoa(s.Idle), itoa(s.InUse), itoa(s.Waiters),
+				strconv.FormatInt(s.Acquired, 10), micros(s.AvgAcquireWait), strconv.FormatBool(s.Ejected),
+				strconv.FormatBool(s.Draining), strconv.FormatBool(s.Paused),
+			})
+		}
+		return c.rows([]string{"group", "backend", "role", "open", "idle", "in_use", "waiters", "acquired", "avg_wait_us", "ejected", "draining", "paused"}, rows)
+	case "CLIENTS":
+		var rows [][]string
+		for _, s := range c.proxy.Sessions() {
+			rows = append(rows, []string{
+				strconv.FormatUint(s.ID, 10), s.User, s.Database, s.ApplicationName, s.ClientAddr,
+				s.State, strconv.FormatBool(s.Pinned), s.ConnectedAt.Format(time.RFC3339),
+			})
+		}
+		return c.rows([]string{"id", "user", "database", "application_name", "client_addr", "state", "pinned", "connected_at"}, rows)
+	case "SERVERS":
+		var rows [][]string
+		for _, s := range c.proxy.Sessions() {
+			if s.Primary != "" {
+				rows = append(rows, []string{"primary", "", s.Primary, s.PrimaryLocal, strconv.FormatUint(s.ID, 10), s.State})
+			}
+			if s.Replica != "" {
+				rows = append(rows, []string{"replica", s.ReplicaGroup, s.Replica, s.ReplicaLocal, strconv.FormatUint(s.ID, 10), s.State})
+			}
+		}
+		return c.rows([]string{"role", "group", "backend", "local_addr", "client_id", "state"}, rows)
+	case "STATS":
+		var rows [][]string
+		for _, s := range c.proxy.clients.Snapshot() {
+			rows = append(rows, []string{
+				s.User, s.Database, s.ApplicationName, strconv.FormatInt(s.Sessions, 10), strconv.FormatInt(s.Queries, 10),
+				strconv.FormatInt(s.Errors, 10), strconv.FormatInt(s.BytesIn, 10), strconv.FormatInt(s.BytesOut, 10), micros(s.Time),
+			})
+		}
+		return c.rows([]string{"user", "database", "application_name", "sessions", "queries", "errors", "bytes_in", "bytes_out", "query_time_us"}, rows)
+	case "QUERIES":
+		var rows [][]string
+		for _, s := range c.proxy.queries.Snapshot() {
+			rows = append(rows, []string{
+				s.Fingerprint, s.Query, strconv.FormatInt(s.Calls, 10), strconv.FormatInt(s.Rows, 10),
+				micros(s.TotalTime), micros(s.MeanTime), micros(s.P99Time), s.Destination,
+			})
+		}
+		return c.rows([]string{"fingerprint", "query", "calls", "rows", "total_time_us", "mean_time_us", "p99_time_us", "destination"}, rows)
+	case "CONFIG":
+		list := c.proxy.config().Admin.Settings
+		if list == nil {
+			return c.writeError("ERROR", "0A000", "SHOW CONFIG is not available")
+		}
+		settings, err := list()
+		if err != nil {
+			return c.writeError("ERROR", "XX000", err.Error())
+		}
+		rows := make([][]string, len(settings))
+		for i, s := range settings {
+			rows[i] = []string{s.Key, s.Value}
+		}
+		return c.rows([]string{"key", "value"}, rows)
+	}
+	return c.writeError("ERROR", "42601", fmt.Sprintf("unknown SHOW target %q, try SHOW HELP", what))
+}
+
+func (c *console) reload() error {
+	restart, err := c.proxy.Reload()
+	if errors.Is(err, ErrReloadUnavailable) {
+		return c.writeError("ERROR", "0A000", "RELOAD is not available")
+	}
+	if err != nil {
+		return c.writeError("ERROR", "F0000", "reload failed: "+err.Error())
+	}
+	if len(restart) > 0 {
+		msg := "changes to " + strings.Join(restart, ", ") + " take effect after a restart"
+		if err := c.write(config.NoticeResponse, errorFields("WARNING", "01000", msg)); err != nil {
+			return err
+		}
+	}
+	return c.complete("RELOAD")
+}
+
+func (c *console) pause() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.proxy.PauseTimeout())
+	defer cancel()
+	if err := c.proxy.Pause(ctx); err != nil {
+		return c.writeError("ERROR", "57014", "pause incomplete, new queries are still held: "+err.Error())
+	}
+	return c.complete("PAUSE")
+}
+
+func (c *console) drain(address string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.proxy.DrainTimeout())
+	defer cancel()
+	err := c.proxy.poolManager.Remove(ctx, address)
+	switch {
+	case errors.Is(err, pool.ErrUnknownBackend):
+		return c.writeError("ERROR", "42704", err.Error())
+	case errors.Is(err, pool.ErrDrainPrimary):
+		return c.writeError("ERROR", "55000", err.Error())
+	case err != nil:
+		return c.writeError("ERROR", "57014", err.Error())
+	}
+	return c.complete("DRAIN")
+}
+
+func (c *console) kill(arg string) error {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return c.writeError("ERROR", "22023", fmt.Sprintf("invalid client id %q", arg))
+	}
+	if !c.proxy.KillSession(id) {
+		return c.writeError("ERROR", "42704", fmt.Sprintf("no client with id %d", id))
+	}
+	return c.complete("KILL")
+}
+
+// rows sends a text result set followed by CommandComplete.
+func (c *console) rows(columns []string, rows [][]string) error {
+	var desc []byte
+	desc = binary.BigEndian.AppendUint16(desc, uint16(len(columns)))
+	for _, col := range columns {
+		desc = append(desc, col...)
+		desc = append(desc, 0)
+		desc = binary.BigEndian.AppendUint32(desc, 0)  // table oid
+		desc = binary.BigEndian.AppendUint16(desc, 0)  // column number
+		desc = binary.BigEndian.AppendUint32(desc, 25) // text
+		desc = binary.BigEndian.AppendUint16(desc, 0xffff)
+		desc = binary.BigEndian.AppendUint32(desc, 0xffffffff) // typmod -1
+		desc = binary.BigEndian.AppendUint16(desc, 0)          // text format
+	}
+	if err := c.write(config.RowDescription, desc); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var data []byte
+		data = binary.BigEndian.AppendUint16(data, uint16(len(row)))
+		for _, v := range row {
+			data = binary.BigEndian.AppendUint32(data, uint32(len(v)))
+			data = append(data, v...)
+		}
+		if err := c.write(config.DataRow, data); err != nil {
+			return err
+		}
+	}
+	return c.complete(fmt.Sprintf("SHOW %d", len(rows)))
+}
+
+func (c *console) complete(tag string) error {
+	return c.write(config.CommandComplete, append([]byte(tag), 0))
+}
+
+func (c *console) ready() error {
+	return c.write(config.ReadyForQuery, []byte{'I'})
+}
+
+func (c *console) writeError(severity, code, message string) error {
+	return c.write(config.ErrorResponse, errorFields(severity, code, message))
+}
+
+// errorFields encodes the body of an ErrorResponse or NoticeResponse.
+func errorFields(severity, code, message string) []byte {
+	var body []byte
+	for _, f := range [][2]string{{"S", severity}, {"V", severity}, {"C", code}, {"M", message}} {
+		body = append(body, f[0][0])
+		body = append(body, f[1]...)
+		body = append(body, 0)
+	}
+	return append(body, 0)
+}
+
+func (c *console) write(typ byte, body []byte) error {
+	msg := make([]byte, 5, 5+len(body))
+	msg[0] = typ
+	binary.BigEndian.PutUint32(msg[1:5], uint32(4+len(body)))
+	_, err := c.conn.Write(append(msg, body...))
+	return err
+}
+
+func (c *console) read() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.conn, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	length := int32(binary.BigEndian.Uint32(hdr[1:5]))
+	if length < 4 || length > 1<<20 {
+		return 0, nil, fmt.Errorf("invalid message length %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], body, nil
+}
+
+func cstrings(ss ...string) []byte {
+	var b []byte
+	for _, s := range ss {
+		b = append(b, s...)
+		b = append(b, 0)
+	}
+	return b
+}
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
+
+func micros(d time.Duration) string {
+	return strconv.FormatInt(d.Microseconds(), 10)
+}
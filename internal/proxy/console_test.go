@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/router"
+)
+
+type message struct {
+	typ  byte
+	body []byte
+}
+
+func startupMessage(params ...string) []byte {
+	body := binary.BigEndian.AppendUint32(nil, 196608)
+	body = append(body, cstrings(params...)...)
+	body = append(body, 0)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(4+len(body))), body...)
+}
+
+func readMessage(t *testing.T, conn net.Conn) message {
+	t.Helper()
+	var hdr [5]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(hdr[1:5])-4)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		t.Fatalf("reading message body: %v", err)
+	}
+	return message{hdr[0], body}
+}
+
+// readUntilReady returns the messages up to and including ReadyForQuery.
+func readUntilReady(t *testing.T, conn net.Conn) []message {
+	t.Helper()
+	var msgs []message
+	for {
+		m := readMessage(t, conn)
+		msgs = append(msgs, m)
+		if m.typ == config.ReadyForQuery || m.typ == config.ErrorResponse && strings.Contains(string(m.body), "FATAL") {
+			return msgs
+		}
+	}
+}
+
+func simpleQuery(t *testing.T, conn net.Conn, q string) []message {
+	t.Helper()
+	body := append([]byte(q), 0)
+	msg := append([]byte{config.QueryMessage}, binary.BigEndian.AppendUint32(nil, uint32(4+len(body)))...)
+	if _, err := conn.Write(append(msg, body...)); err != nil {
+		t.Fatalf("writing query: %v", err)
+	}
+	return readUntilReady(t, conn)
+}
+
+// dataRows decodes the DataRow messages of a result.
+func dataRows(msgs []message) [][]string {
+	var rows [][]string
+	for _, m := range msgs {
+		if m.typ != config.DataRow {
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(m.body))
+		b := m.body[2:]
+		row := make([]string, n)
+		for i := range row {
+			l := int(binary.BigEndian.Uint32(b))
+			row[i] = string(b[4 : 4+l])
+			b = b[4+l:]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func newTestProxy(t *testing.T, admin AdminConfig) *Proxy {
+	t.Helper()
+	pm := pool.NewPoolManagerWithConfig("127.0.0.1:1", []pool.Node{{Address: "127.0.0.1:2"}},
+		pool.Config{MaxSize: 1, AcquireTimeout: time.Second}, pool.Config{MaxSize: 1, AcquireTimeout: time.Second})
+	t.Cleanup(pm.Close)
+	return NewProxy(ProxyConfig{Admin: admin}, pm, router.NewRouter())
+}
+
+func connectConsole(t *testing.T, p *Proxy, user string) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go func() {
+		defer server.Close()
+		p.HandleClient(server)
+	}()
+	if _, err := client.Write(startupMessage("user", user, "database", "pggate")); err != nil {
+		t.Fatalf("writing startup message: %v", err)
+	}
+	return client
+}
+
+// login answers the password request of the console and returns the
+// messages up to ReadyForQuery or the error.
+func login(t *testing.T, conn net.Conn, password string) []message {
+	t.Helper()
+	if m := readMessage(t, conn); m.typ != config.Authentification || binary.BigEndian.Uint32(m.body) != 3 {
+		t.Fatalf("expected AuthenticationCleartextPassword, got %c %v", m.typ, m.body)
+	}
+	body := append([]byte(password), 0)
+	msg := append([]byte{config.PasswordMessage}, binary.BigEndian.AppendUint32(nil, uint32(4+len(body)))...)
+	if _, err := conn.Write(append(msg, body...)); err != nil {
+		t.Fatalf("writing password: %v", err)
+	}
+	return readUntilReady(t, conn)
+}
+
+func TestConsole(t *testing.T) {
+	reloaded := false
+	p := newTestProxy(t, AdminConfig{
+		Users:    []string{"admin"},
+		Password: "s3cret",
+		Reload:   func() ([]string, error) { reloaded = true; return []string{"listener.address"}, nil },
+		Settings: func() ([]config.Setting, error) {
+			return []config.Setting{{Key: "listener.address", Value: ":5432"}}, nil
+		},
+	})
+	conn := connectConsole(t, p, "admin")
+	if msgs := login(t, conn, "s3cret"); msgs[0].typ != config.Authentification || msgs[len(msgs)-1].typ != config.ReadyForQuery {
+		t.Fatalf("startup = %v, want AuthenticationOk ... ReadyForQuery", msgs)
+	}
+
+	msgs := simpleQuery(t, conn, "show pools;")
+	if msgs[0].typ != config.RowDescription {
+		t.Fatalf("SHOW POOLS first message = %c, want RowDescription", msgs[0].typ)
+	}
+	rows := dataRows(msgs)
+	if len(rows) != 2 || rows[0][1] != "127.0.0.1:1" || rows[0][2] != "primary" || rows[1][2] != "replica" {
+		t.Errorf("SHOW POOLS rows = %v", rows)
+	}
+	if tag := string(msgs[len(msgs)-2].body); tag != "SHOW 2\x00" {
+		t.Errorf("SHOW POOLS tag = %q, want SHOW 2", tag)
+	}
+
+	if rows := dataRows(simpleQuery(t, conn, "SHOW CONFIG")); len(rows) != 1 || rows[0][0] != "listener.address" {
+		t.Errorf("SHOW CONFIG rows = %v", rows)
+	}
+
+	msgs = simpleQuery(t, conn, "RELOAD")
+	if !reloaded || msgs[0].typ != config.NoticeResponse || msgs[1].typ != config.CommandComplete {
+		t.Errorf("RELOAD = %v, reloaded %v", msgs, reloaded)
+	} else if notice := string(msgs[0].body); !strings.Contains(notice, "listener.address") {
+		t.Errorf("RELOAD notice = %q, want listener.address", notice)
+	}
+
+	for _, q := range []string{"PAUSE", "RESUME"} {
+		if msgs := simpleQuery(t, conn, q); msgs[0].typ != config.CommandComplete {
+			t.Errorf("%s = %v, want CommandComplete", q, msgs)
+		}
+	}
+	if p.Paused() {
+		t.Error("still paused after RESUME")
+	}
+
+	// a client session to list and kill
+	clientSide, sessionSide := net.Pipe()
+	defer sessionSide.Close()
+	s := &Session{id: 42, clientConn: clientSide, proxy: p, log: slog.Default(), killed: make(chan struct{})}
+	s.status = SessionInfo{ID: 42, User: "app", State: StateIdle}
+	p.addSession(s)
+	rows = dataRows(simpleQuery(t, conn, "SHOW CLIENTS"))
+	if len(rows) != 1 || rows[0][0] != "42" || rows[0][1] != "app" {
+		t.Errorf("SHOW CLIENTS rows = %v", rows)
+	}
+	if msgs := simpleQuery(t, conn, "KILL 42"); msgs[0].typ != config.CommandComplete {
+		t.Errorf("KILL 42 = %v, want CommandComplete", msgs)
+	}
+	if _, err := clientSide.Write([]byte{0}); err == nil {
+		t.Errorf("killed session connection is still open")
+	}
+
+	for _, q := range []string{"KILL 999", "KILL abc", "DRAIN 127.0.0.1:9", "DRAIN 127.0.0.1:1", "SHOW NOTHING", "DROP TABLE x"} {
+		if msgs := simpleQuery(t, conn, q); msgs[0].typ != config.ErrorResponse || msgs[1].typ != config.ReadyForQuery {
+			t.Errorf("%s = %v, want ErrorResponse then ReadyForQuery", q, msgs)
+		}
+	}
+}
+
+func TestConsole_Auth(t *testing.T) {
+	p := newTestProxy(t, AdminConfig{Users: []string{"admin"}, Password: "s3cret"})
+
+	conn := connectConsole(t, p, "app")
+	if msgs := readUntilReady(t, conn); msgs[0].typ != config.ErrorResponse || !strings.Contains(string(msgs[0].body), "28000") {
+		t.Errorf("disallowed user got %v, want FATAL 28000", msgs)
+	}
+
+	for _, tt := range []struct {
+		password string
+		ok       bool
+	}{{"wrong", false}, {"s3cret", true}} {
+		msgs := login(t, connectConsole(t, p, "admin"), tt.password)
+		if ok := msgs[len(msgs)-1].typ == config.ReadyForQuery; ok != tt.ok {
+			t.Errorf("password %q: authenticated = %v, want %v", tt.password, ok, tt.ok)
+		}
+	}
+}
+
+func TestConsole_NoPassword(t *testing.T) {
+	reloaded := false
+	p := newTestProxy(t, AdminConfig{
+		Users:  []string{"admin"},
+		Reload: func() ([]string, error) { reloaded = true; return nil, nil },
+	})
+	conn := connectConsole(t, p, "admin")
+	if msgs := readUntilReady(t, conn); msgs[len(msgs)-1].typ != config.ReadyForQuery {
+		t.Fatalf("startup = %v, want ReadyForQuery", msgs)
+	}
+
+	if msgs := simpleQuery(t, conn, "SHOW POOLS"); msgs[0].typ != config.RowDescription {
+		t.Errorf("SHOW POOLS without a password = %v, want rows", msgs)
+	}
+	for _, q := range []string{"RELOAD", "PAUSE", "RESUME", "KILL 1", "DRAIN 127.0.0.1:2"} {
+		msgs := simpleQuery(t, conn, q)
+		if msgs[0].typ != config.ErrorResponse || !strings.Contains(string(msgs[0].body), "C42501\x00") {
+			t.Errorf("%s without a password = %v, want ErrorResponse 42501", q, msgs)
+		}
+	}
+	if reloaded || p.Paused() {
+		t.Errorf("refused commands ran: reloaded %v, paused %v", reloaded, p.Paused())
+	}
+}
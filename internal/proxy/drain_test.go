@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/router"
+)
+
+// fakeReplica listens for pool connections and answers every simple query
+// with CommandComplete and ReadyForQuery. closed receives when a connection
+// is closed by the proxy.
+func fakeReplica(t *testing.T) (addr string, closed chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closed = make(chan struct{}, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var hdr [5]byte
+					if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+						closed <- struct{}{}
+						return
+					}
+					if _, err := io.CopyN(io.Discard, conn, int64(binary.BigEndian.Uint32(hdr[1:])-4)); err != nil {
+						closed <- struct{}{}
+						return
+					}
+					if hdr[0] == config.QueryMessage {
+						conn.Write(append(frontendMessage(config.CommandComplete, "SELECT 1"), config.ReadyForQuery, 0, 0, 0, 5, 'I'))
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), closed
+}
+
+// newReplicaTestProxy returns a proxy with a reachable replica and a session
+// that has read from it and is now waiting for its next query.
+func newReplicaTestProxy(t *testing.T) (p *Proxy, pm *pool.PoolManager, replica string, closed chan struct{}) {
+	t.Helper()
+	replica, closed = fakeReplica(t)
+	cfg := pool.Config{MaxSize: 1, AcquireTimeout: time.Second}
+	pm = pool.NewPoolManagerWithConfig("127.0.0.1:1", []pool.Node{{Address: replica}}, cfg, cfg)
+	t.Cleanup(pm.Close)
+	p = NewProxy(ProxyConfig{}, pm, router.NewRouter())
+
+	client, s := runTestSession(p, 1, false, fakeBackend(t))
+	t.Cleanup(func() { client.Close() })
+	if msgs := simpleQuery(t, client, "SELECT 1"); msgs[0].typ == config.ErrorResponse {
+		t.Fatalf("SELECT 1 failed: %q", msgs[0].body)
+	}
+	for deadline := time.Now().Add(time.Second); !s.idleRead.Load() || p.Sessions()[0].Replica != replica; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("session not idle on the replica: %+v", p.Sessions())
+		}
+	}
+	return p, pm, replica, closed
+}
+
+func TestSession_DrainIdle(t *testing.T) {
+	p, pm, replica, _ := newReplicaTestProxy(t)
+
+	// the idle session hands its connection back right away instead of on
+	// its next query
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := pm.Remove(ctx, replica); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Remove() took %v with an idle session on the replica", d)
+	}
+	if si := p.Sessions()[0]; si.Replica != "" {
+		t.Errorf("session still holds replica %s after Remove()", si.Replica)
+	}
+}
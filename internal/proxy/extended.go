@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"bytes"
+
+	"github.com/user/pggate/internal/config"
+)
+
+// trackStatement follows the names of prepared statements and portals
+// through the extended protocol, so a Bind or Execute of a statement parsed
+// in an earlier request can be accounted to its query text. It returns the
+// query a Parse, Bind or Execute runs, empty when unknown.
+func (s *Session) trackStatement(msgType byte, body []byte) string {
+	switch msgType {
+	case config.ParseMessage:
+		name, _ := cString(body)
+		query := s.extractQueryFromParse(body)
+		if s.statements == nil {
+			s.statements = make(map[string]string)
+		}
+		s.statements[name] = query
+		return query
+	case config.BindMessage:
+		portal, rest := cString(body)
+		stmt, _ := cString(rest)
+		if s.portals == nil {
+			s.portals = make(map[string]string)
+		}
+		s.portals[portal] = s.statements[stmt]
+		return s.portals[portal]
+	case config.ExecuteMessage:
+		portal, _ := cString(body)
+		return s.portals[portal]
+	case config.CloseMessage:
+		if len(body) == 0 {
+			return ""
+		}
+		name, _ := cString(body[1:])
+		switch body[0] {
+		case 'S':
+			delete(s.statements, name)
+		case 'P':
+			delete(s.portals, name)
+		}
+	}
+	return ""
+}
+
+// cString splits the null-terminated string off the front of b.
+func cString(b []byte) (string, []byte) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return string(b), nil
+	}
+	return string(b[:i]), b[i+1:]
+}
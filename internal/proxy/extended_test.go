@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/router"
+)
+
+func frontendMessage(typ byte, fields ...string) []byte {
+	var body []byte
+	for _, f := range fields {
+		body = append(append(body, f...), 0)
+	}
+	msg := []byte{typ, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msg[1:], uint32(4+len(body)))
+	return append(msg, body...)
+}
+
+// fakeBackend answers extended-protocol batches on the returned connection:
+// ParseComplete, BindComplete and CommandComplete for the messages before
+// each Sync, then ReadyForQuery. Simple queries get CommandComplete and
+// ReadyForQuery, in a transaction after BEGIN until COMMIT.
+func fakeBackend(t *testing.T) net.Conn {
+	t.Helper()
+	proxySide, backend := net.Pipe()
+	t.Cleanup(func() { backend.Close() })
+	go func() {
+		var reply []byte
+		status := byte('I')
+		for {
+			var hdr [5]byte
+			if _, err := io.ReadFull(backend, hdr[:]); err != nil {
+				return
+			}
+			body := make([]byte, binary.BigEndian.Uint32(hdr[1:])-4)
+			if _, err := io.ReadFull(backend, body); err != nil {
+				return
+			}
+			switch hdr[0] {
+			case config.QueryMessage:
+				tag, _, _ := strings.Cut(router.StripLeadingComments(strings.TrimRight(string(body), "\x00")), " ")
+				switch tag = strings.ToUpper(tag); tag {
+				case "BEGIN":
+					status = 'T'
+				case "COMMIT", "ROLLBACK":
+					status = 'I'
+				}
+				msg := append(frontendMessage(config.CommandComplete, tag), config.ReadyForQuery, 0, 0, 0, 5, status)
+				if _, err := backend.Write(msg); err != nil {
+					return
+				}
+			case config.ParseMessage:
+				reply = append(reply, '1', 0, 0, 0, 4)
+			case config.BindMessage:
+				reply = append(reply, '2', 0, 0, 0, 4)
+			case config.ExecuteMessage:
+				reply = append(reply, frontendMessage(config.CommandComplete, "UPDATE 1")...)
+			case config.SyncMessage:
+				reply = append(reply, config.ReadyForQuery, 0, 0, 0, 5, 'I')
+				if _, err := backend.Write(reply); err != nil {
+					return
+				}
+				reply = nil
+			}
+		}
+	}()
+	return proxySide
+}
+
+func TestSession_PreparedStatementWithoutParse(t *testing.T) {
+	p := newTestProxy(t, AdminConfig{})
+	client, _ := runTestSession(p, 1, false, fakeBackend(t))
+	defer client.Close()
+
+	send := func(msgs ...[]byte) {
+		t.Helper()
+		for _, m := range msgs {
+			if _, err := client.Write(m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		readUntilReady(t, client)
+	}
+	send(frontendMessage(config.ParseMessage, "s1", "UPDATE t SET a = 1 WHERE id = $1\x00\x00"),
+		frontendMessage(config.SyncMessage))
+	for range 2 {
+		// Bind: portal, statement, no parameter formats, values or result formats
+		send(frontendMessage(config.BindMessage, "", "s1\x00\x00\x00\x00\x00\x00"),
+			frontendMessage(config.ExecuteMessage, "", "\x00\x00\x00"),
+			frontendMessage(config.SyncMessage))
+	}
+
+	// the last call is recorded after ReadyForQuery is relayed
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		qs := p.QueryStats().Snapshot()
+		if len(qs) == 1 && qs[0].Calls == 3 && qs[0].Rows == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("query stats = %+v, want one query with 3 calls and 2 rows", qs)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package proxy
+
+import "github.com/user/pggate/internal/metrics"
+
+var (
+	totalQueries   = metrics.NewCounter("pggate_total_queries_total", "Total number of queries handled")
+	primaryQueries = metrics.NewCounter("pggate_primary_queries_total", "Total number of queries routed to primary")
+	replicaQueries = metrics.NewCounter("pggate_replica_queries_total", "Total number of queries routed to replicas")
+	errorsSent     = metrics.NewCounter("pggate_errors_total", "Total number of errors returned to clients by the proxy")
+)
+
+// Latency histograms of the query path. destination is primary or replica,
+// backend the node address and statement the kind of SQL statement.
+var (
+	queryDuration = metrics.NewHistogramVec("pggate_query_duration_seconds",
+		"End-to-end query latency from client request to ReadyForQuery",
+		metrics.DefaultLatencyBuckets, "destination", "backend", "statement")
+	queryFirstByte = metrics.NewHistogramVec("pggate_query_first_byte_seconds",
+		"Time from forwarding a query to the first byte of the backend response",
+		metrics.DefaultLatencyBuckets, "destination", "backend", "statement")
+	acquireWait = metrics.NewHistogramVec("pggate_session_acquire_seconds",
+		"Time sessions spent acquiring a backend connection",
+		metrics.DefaultLatencyBuckets, "destination", "backend")
+	handshakeDuration = metrics.NewHistogramVec("pggate_handshake_duration_seconds",
+		"Client startup, authentication and session setup time",
+		metrics.DefaultLatencyBuckets, "backend")
+)
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/user/pggate/internal/pool"
+)
+
+// pausePollInterval is how often Pause checks for busy sessions.
+var pausePollInterval = 10 * time.Millisecond
+
+// ErrResumed is returned by Pause when Resume is called before the pause
+// completed.
+var ErrResumed = errors.New("resumed before the pause completed")
+
+// Pause holds new queries until Resume, for backend maintenance: the pools
+// stop handing out connections and close their idle ones, sessions give back
+// their replica connections once outside a transaction, and wait before
+// their next query. It returns once no
+// session is running a query or has a transaction open. If ctx ends first
+// PgGate stays paused and the context error is returned.
+func (p *Proxy) Pause(ctx context.Context) error {
+	p.pauseMu.Lock()
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+		p.poolManager.Pause()
+		slog.Info("pausing, holding new queries")
+	}
+	resumed := p.resumed
+	p.pauseMu.Unlock()
+	// replica connections held by idle sessions would break if the replica
+	// restarts; returned to the paused pools they are closed
+	p.releaseIdleReplicas(func(*pool.Pool) bool { return true })
+
+	ticker := time.NewTicker(pausePollInterval)
+	defer ticker.Stop()
+	for {
+		busy := p.busySessions()
+		if busy == 0 {
+			slog.Info("paused")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d sessions still busy: %w", busy, ctx.Err())
+		case <-resumed:
+			return ErrResumed
+		case <-ticker.C:
+		}
+	}
+}
+
+// PauseTimeout is the configured bound on Pause, see AdminConfig.
+func (p *Proxy) PauseTimeout() time.Duration {
+	return p.config().Admin.pauseTimeout()
+}
+
+// Resume releases the queries held by Pause.
+func (p *Proxy) Resume() {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	if p.resumed == nil {
+		return
+	}
+	p.poolManager.Resume()
+	close(p.resumed)
+	p.resumed = nil
+	slog.Info("resumed")
+}
+
+func (p *Proxy) Paused() bool {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+	return p.resumed != nil
+}
+
+// busySessions counts the sessions running a query or holding a
+// transaction open.
+func (p *Proxy) busySessions() int {
+	n := 0
+	for _, s := range p.Sessions() {
+		if s.State == StateActive || s.InTransaction {
+			n++
+		}
+	}
+	return n
+}
+
+// waitResumed marks the session active before a client message is sent to
+// a backend, holding it while PgGate is paused unless it is inside a
+// transaction or an extended-protocol request. The state is published before
+// the pause is checked, so Pause either sees the session active and waits
+// for it, or the session sees the pause. It returns false if the session was
+// killed meanwhile.
+func (s *Session) waitResumed() bool {
+	for {
+		s.updateStatus(StateActive)
+		if s.inTransaction || s.req != nil {
+			return true
+		}
+		s.proxy.pauseMu.Lock()
+		resumed := s.proxy.resumed
+		s.proxy.pauseMu.Unlock()
+		if resumed == nil {
+			return true
+		}
+		s.updateStatus(StateWaiting)
+		s.log.Debug("query held while paused")
+		select {
+		case <-resumed:
+		case <-s.killed:
+			return false
+		}
+	}
+}
+
+// waitState publishes StateWaiting before a pool acquisition that will queue
+// because the pools are paused, so Pause does not wait on sessions it holds
+// up itself. It returns the state to restore once the connection is
+// acquired.
+func (s *Session) waitState() string {
+	if !s.proxy.poolManager.Paused() {
+		return ""
+	}
+	prev := s.Info().State
+	s.updateStatus(StateWaiting)
+	return prev
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/config"
+)
+
+func addTestSession(p *Proxy, id uint64, state string, inTx bool) *Session {
+	client, _ := net.Pipe()
+	s := &Session{id: id, clientConn: client, proxy: p, log: slog.Default(), killed: make(chan struct{})}
+	s.inTransaction = inTx
+	s.status = SessionInfo{ID: id, State: state, InTransaction: inTx}
+	p.addSession(s)
+	return s
+}
+
+func TestProxy_Pause(t *testing.T) {
+	p := newTestProxy(t, AdminConfig{})
+	addTestSession(p, 1, StateIdle, false)
+	busy := addTestSession(p, 2, StateIdleInTx, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Pause(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Pause() with an open transaction error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !p.Paused() || !p.poolManager.Paused() {
+		t.Fatal("Pause() timing out did not leave PgGate paused")
+	}
+
+	// a session outside a transaction is held until Resume
+	held := make(chan bool, 1)
+	go func() { held <- addTestSession(p, 3, StateIdle, false).waitResumed() }()
+
+	busy.inTransaction = false
+	busy.updateStatus(StateIdle)
+	if err := p.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	select {
+	case <-held:
+		t.Fatal("waitResumed() returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p.Resume()
+	if ok := <-held; !ok || p.Paused() || p.poolManager.Paused() {
+		t.Errorf("after Resume() waitResumed() = %v, paused = %v", ok, p.Paused())
+	}
+}
+
+func TestProxy_PauseKill(t *testing.T) {
+	p := newTestProxy(t, AdminConfig{})
+	s := addTestSession(p, 1, StateIdle, false)
+	if err := p.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	defer p.Resume()
+
+	held := make(chan bool, 1)
+	go func() { held <- s.waitResumed() }()
+	p.KillSession(1)
+	select {
+	case ok := <-held:
+		if ok {
+			t.Error("waitResumed() = true for a killed session")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("killed session still held by Pause")
+	}
+}
+
+func TestProxy_PauseHoldsExtendedQuery(t *testing.T) {
+	p := newTestProxy(t, AdminConfig{})
+	client, s := runTestSession(p, 1, false, fakeBackend(t))
+	defer client.Close()
+	if err := p.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+
+	replied := make(chan []message, 1)
+	go func() {
+		for _, m := range [][]byte{
+			frontendMessage(config.BindMessage, "", "s1\x00\x00\x00\x00\x00\x00"),
+			frontendMessage(config.ExecuteMessage, "", "\x00\x00\x00"),
+			frontendMessage(config.SyncMessage),
+		} {
+			if _, err := client.Write(m); err != nil {
+				return
+			}
+		}
+		replied <- readUntilReady(t, client)
+	}()
+	for deadline := time.Now().Add(time.Second); s.Info().State != StateWaiting; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("session state = %q while paused, want %q", s.Info().State, StateWaiting)
+		}
+	}
+	select {
+	case <-replied:
+		t.Fatal("Bind was sent to the backend while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p.Resume()
+	select {
+	case msgs := <-replied:
+		if len(msgs) != 3 || msgs[0].typ != '2' {
+			t.Errorf("after Resume() got %d messages starting with %c, want BindComplete, CommandComplete, ReadyForQuery", len(msgs), msgs[0].typ)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Bind still held after Resume()")
+	}
+}
+
+func TestSession_WaitResumedMarksActive(t *testing.T) {
+	p := newTestProxy(t, AdminConfig{})
+	s := addTestSession(p, 1, StateIdle, false)
+	if !s.waitResumed() || s.Info().State != StateActive {
+		t.Fatalf("waitResumed() left state %q, want %q", s.Info().State, StateActive)
+	}
+	// Pause waits for a session that got past waitResumed
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Pause(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Pause() with an active session error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	p.Resume()
+}
+
+func TestProxy_PauseReleasesReplica(t *testing.T) {
+	p, _, _, closed := newReplicaTestProxy(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Pause(ctx); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	defer p.Resume()
+	if si := p.Sessions()[0]; si.Replica != "" {
+		t.Errorf("idle session still holds replica %s while paused", si.Replica)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("replica connection of the idle session not closed by Pause()")
+	}
+}
@@ -1,16 +1,27 @@
 package proxy
 
 import (
+	"bytes"
+	"cmp"
+	"container/list"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/user/pggate/internal/config"
-	"github.com/user/pggate/internal/metrics"
 	"github.com/user/pggate/internal/pool"
 	"github.com/user/pggate/internal/router"
+	"github.com/user/pggate/internal/slowlog"
+	"github.com/user/pggate/internal/stats"
+	"github.com/user/pggate/internal/tracing"
 )
 
 const (
@@ -21,46 +32,208 @@ type ProxyInt interface {
 	HandleClient(clientConn net.Conn)
 }
 
+type ProxyConfig struct {
+	// HashKey selects the session attribute used as the client key for
+	// hash-based replica balancing: user, database, application_name or
+	// client_addr.
+	HashKey string
+	// Sticky keeps reads on the same replica while it stays healthy:
+	// "session" for the lifetime of a client session, "user" or
+	// "application_name" for every session sharing that value. Sessions
+	// without that value are sticky on their own.
+	Sticky string
+	// MaxClientStats bounds the distinct user/database/application_name
+	// combinations tracked in client statistics.
+	MaxClientStats int
+	// MaxQueryStats bounds the query fingerprints tracked.
+	MaxQueryStats int
+	// SlowLog records queries over its threshold; nil disables it.
+	SlowLog *slowlog.Logger
+	// LogQueries logs the text of every query: "" (off), "redacted" with
+	// literals replaced by placeholders, or "full".
+	LogQueries string
+	// Tracer records spans of handshakes and queries; nil disables tracing.
+	Tracer *tracing.Tracer
+	Admin  AdminConfig
+}
+
 type Proxy struct {
+	cfg         atomic.Pointer[ProxyConfig] // see SetConfig
 	poolManager *pool.PoolManager
-	router      *router.Router
+	clients     *stats.Clients
+	queries     *stats.Queries
+
+	stickyMu  sync.Mutex
+	sticky    map[string]*list.Element // group + sticky key -> *stickyEntry in stickyLRU
+	stickyLRU list.List                // most recently used first
+
+	sessionsMu sync.Mutex
+	sessions   map[uint64]*Session
+
+	routerMu sync.RWMutex
+	router   router.Routing
+
+	pauseMu sync.Mutex
+	resumed chan struct{} // non-nil while paused, closed by Resume
+
+	shuttingDown atomic.Bool // see Shutdown
 }
 
-func NewProxy(pm *pool.PoolManager, r *router.Router) *Proxy {
-	return &Proxy{
+func NewProxy(cfg ProxyConfig, pm *pool.PoolManager, r router.Routing) *Proxy {
+	p := &Proxy{
 		poolManager: pm,
 		router:      r,
+		clients:     stats.NewClients(cfg.MaxClientStats),
+		queries:     stats.NewQueries(cfg.MaxQueryStats),
+		sticky:      make(map[string]*list.Element),
+		sessions:    make(map[uint64]*Session),
 	}
+	p.cfg.Store(&cfg)
+	pm.OnRetire(p.retired)
+	return p
+}
+
+// SetConfig applies a new configuration to running and future sessions.
+// MaxClientStats, MaxQueryStats, SlowLog and Tracer keep the values the
+// proxy was created with.
+func (p *Proxy) SetConfig(cfg ProxyConfig) {
+	old := p.config()
+	cfg.MaxClientStats, cfg.MaxQueryStats = old.MaxClientStats, old.MaxQueryStats
+	cfg.SlowLog, cfg.Tracer = old.SlowLog, old.Tracer
+	p.cfg.Store(&cfg)
+}
+
+func (p *Proxy) config() *ProxyConfig {
+	return p.cfg.Load()
+}
+
+// SetRouter replaces the routing of future queries.
+func (p *Proxy) SetRouter(r router.Routing) {
+	p.routerMu.Lock()
+	defer p.routerMu.Unlock()
+	p.router = r
+}
+
+func (p *Proxy) routing() router.Routing {
+	p.routerMu.RLock()
+	defer p.routerMu.RUnlock()
+	return p.router
 }
 
+// ClientStats returns the per user, database and application_name query
+// statistics.
+func (p *Proxy) ClientStats() *stats.Clients {
+	return p.clients
+}
+
+// QueryStats returns the per fingerprint query statistics.
+func (p *Proxy) QueryStats() *stats.Queries {
+	return p.queries
+}
+
+var nextSessionID atomic.Uint64
+
 type Session struct {
+	id                  uint64
+	log                 *slog.Logger // carries the session context fields
 	clientConn          net.Conn
 	backendRWConn       net.Conn
 	backendROConn       net.Conn
 	backendROPool       *pool.Pool
+	backendROGroup      string // group backendROConn was taken from
+	roGroup             string // group chosen by the last routing decision
 	inTransaction       bool
-	extendedDest        router.Destination 
-	hasSessionVariables bool             
+	extendedDest        router.Destination
+	req                 *request // client request being relayed
+	hasSessionVariables bool
+	params              map[string]string     // StartupMessage parameters
+	stickyPools         map[string]*pool.Pool // replica per group for Sticky "session"
+	statements          map[string]string     // prepared statement name to query text
+	portals             map[string]string     // portal name to query text
+	client              *stats.ClientCounters
+	span                *tracing.Span // current operation, parent of pool acquisitions
 	proxy               *Proxy
+
+	statusMu sync.Mutex
+	status   SessionInfo // published by updateStatus
+
+	killed    chan struct{} // closed by kill
+	killOnce  sync.Once
+	backendMu sync.Mutex  // guards setting the backend connections, read by kill
+	idleMu    sync.Mutex  // held to change idleRead and by releaseIdleRO
+	idleRead  atomic.Bool // waiting for a query between transactions
+}
+
+// request tracks the client request currently being relayed, for latency
+// accounting. An extended-protocol request spans Parse to Sync.
+type request struct {
+	received time.Time // client message read
+	sent     time.Time // first message forwarded to the backend
+	query    string
+	stmt     router.StatementType
+	span     *tracing.Span
 }
 
 func (p *Proxy) HandleClient(clientConn net.Conn) {
+	start := time.Now()
+	hs := p.config().Tracer.StartAt(tracing.SpanContext{}, "pggate.handshake", tracing.KindServer, start)
+	hs.SetAttr("client.address", clientConn.RemoteAddr().String())
+	defer hs.End()
 	startupMsg, err := HandleHandshake(clientConn)
 	if err != nil {
-		log.Printf("handshake error: %v", err)
+		hs.SetError(err)
+		slog.Warn("handshake failed", "client_addr", clientConn.RemoteAddr().String(), "err", err)
+		return
+	}
+	if params := parseStartupParams(startupMsg); p.isConsole(params) {
+		hs.End()
+		p.serveConsole(clientConn, params)
 		return
 	}
 
 	session := &Session{
+		id:         nextSessionID.Add(1),
 		clientConn: clientConn,
+		params:     parseStartupParams(startupMsg),
 		proxy:      p,
+		killed:     make(chan struct{}),
+	}
+	sc := session.routingContext()
+	session.log = slog.With("session", session.id, "client_addr", sc.ClientAddr, "user", sc.User, "database", sc.Database)
+	session.status = SessionInfo{
+		ID:              session.id,
+		User:            sc.User,
+		Database:        sc.Database,
+		ApplicationName: sc.ApplicationName,
+		ClientAddr:      sc.ClientAddr,
+		ConnectedAt:     start,
+		State:           StateAuthenticating,
 	}
+	p.addSession(session)
+	defer p.removeSession(session)
+	session.client = p.clients.For(stats.ClientKey{User: sc.User, Database: sc.Database, ApplicationName: sc.ApplicationName})
+	session.client.SessionStarted()
+	defer session.client.SessionEnded()
+	session.client.Received(len(startupMsg))
 	defer session.Cleanup()
 
-	if err := session.Init(startupMsg); err != nil {
-		log.Printf("session init error: %v", err)
+	hs.SetAttr("db.user", sc.User)
+	hs.SetAttr("db.name", sc.Database)
+	session.span = hs
+	auth := hs.Child("pggate.authenticate", tracing.KindClient)
+	auth.SetAttr("server.address", p.poolManager.RWPool.Address())
+	err = session.Init(startupMsg)
+	session.span = nil
+	auth.SetError(err)
+	auth.End()
+	if err != nil {
+		hs.SetError(err)
+		session.log.Warn("session init failed", "backend", p.poolManager.RWPool.Address(), "err", err)
 		return
 	}
+	session.log.Debug("session started")
+	handshakeDuration.With(p.poolManager.RWPool.Address()).ObserveDuration(time.Since(start))
+	hs.End()
 
 	session.Run()
 }
@@ -69,68 +242,97 @@ func (s *Session) Init(startupMsg []byte) error {
 	//auth is handled by the master postgres
 	conn, err := s.getBackendConn(router.Primary)
 	if err != nil {
+		s.sendBackendError(err)
 		return fmt.Errorf("failed to get primary connection for init: %w", err)
 	}
 	if _, err := conn.Write(startupMsg); err != nil {
 		return fmt.Errorf("failed to forward startup message: %w", err)
 	}
-	return s.proxyResponse(conn)
+	if err := s.proxyResponse(conn); err != nil {
+		return err
+	}
+	s.proxy.poolManager.RWPool.MarkStarted(conn)
+	return nil
 }
 
 func (s *Session) Run() {
 	buf := make([]byte, 8192)
 	//header we know its 1 byte for type and then 4 bytes for lendgh in postgress wire protocol
 	for {
-		if _, err := io.ReadFull(s.clientConn, buf[:1]); err != nil {
-			if err != io.EOF {
-				log.Printf("error reading message type: %v", err)
+		if s.req == nil && !s.inTransaction && s.backendROPool != nil &&
+			(s.backendROPool.Draining() || s.proxy.poolManager.Paused()) {
+			// hand the connection back so the replica can be removed or
+			// restarted
+			s.releaseROIfSafe()
+		}
+		s.updateStatus(StateIdle)
+		if s.shutdownIdle() {
+			return
+		}
+		_, err := io.ReadFull(s.clientConn, buf[:1])
+		s.setIdle(false)
+		if err != nil {
+			if err != io.EOF && !s.shutdownInterrupted(err) {
+				s.log.Warn("error reading message type", "err", err)
 			}
 			return
 		}
 
 		msgType := buf[0]
 		if _, err := io.ReadFull(s.clientConn, buf[1:5]); err != nil {
-			log.Printf("error reading message length: %v", err)
+			if !s.shutdownInterrupted(err) {
+				s.log.Warn("error reading message length", "err", err)
+			}
 			return
 		}
 
 		length := int32(binary.BigEndian.Uint32(buf[1:5]))
 		if length < 4 {
-			log.Printf("invalid message length: %d", length)
+			s.log.Warn("invalid message length", "length", length)
 			return
 		}
 		msgBody := make([]byte, length-4)
 		if _, err := io.ReadFull(s.clientConn, msgBody); err != nil {
-			log.Printf("error reading message body: %v", err)
+			if !s.shutdownInterrupted(err) {
+				s.log.Warn("error reading message body", "err", err)
+			}
+			return
+		}
+		s.client.Received(5 + len(msgBody))
+		if msgType != config.TerminateMessage && !s.waitResumed() {
 			return
 		}
 		//here we handle query
 		if msgType == config.QueryMessage {
-			metrics.IncTotalQueries()
+			totalQueries.Inc()
+			s.client.Query()
 			query := string(msgBody[:len(msgBody)-1])
-			log.Printf("received query: %s", query)
+			s.logQuery("query", query)
+			s.beginRequest(query)
 
-			dest := s.proxy.router.Route(query, s.inTransaction || s.hasSessionVariables)
+			dest := s.route(query, false)
 			if dest == router.Primary {
-				metrics.IncPrimaryQueries()
+				primaryQueries.Inc()
 			} else {
-				metrics.IncReplicaQueries()
+				replicaQueries.Inc()
 			}
 
 			conn, err := s.getBackendConn(dest)
 			if err != nil {
-				log.Printf("failed to get backend connection: %v", err)
+				s.log.Error("failed to get backend connection", "destination", dest.String(), "err", err)
+				s.sendBackendError(err)
 				return
 			}
 
+			s.req.sent = time.Now()
 			// send to backend postgress
 			if _, err := conn.Write(append([]byte{msgType}, append(buf[1:5], msgBody...)...)); err != nil {
-				log.Printf("error forwarding query to backend: %v", err)
+				s.log.Error("error forwarding query to backend", "backend", s.backendAddr(conn), "err", err)
 				return
 			}
 
 			if err := s.proxyResponse(conn); err != nil {
-				log.Printf("error proxying response: %v", err)
+				s.log.Error("error proxying response", "backend", s.backendAddr(conn), "err", err)
 				return
 			}
 
@@ -143,17 +345,21 @@ func (s *Session) Run() {
 
 			if router.IsSessionModification(query) {
 				s.hasSessionVariables = true
-				s.releaseROIfSafe() 
+				s.releaseROIfSafe()
 			}
 		} else if msgType == config.ParseMessage {
-			metrics.IncTotalQueries()
-			query := s.extractQueryFromParse(msgBody)
-			log.Printf("received Parse: %s", query)
-			s.extendedDest = s.proxy.router.Route(query, s.inTransaction || s.hasSessionVariables)
+			totalQueries.Inc()
+			s.client.Query()
+			query := s.trackStatement(msgType, msgBody)
+			s.logQuery("parse", query)
+			if s.req == nil {
+				s.beginRequest(query)
+			}
+			s.extendedDest = s.route(query, true)
 			if s.extendedDest == router.Primary {
-				metrics.IncPrimaryQueries()
+				primaryQueries.Inc()
 			} else {
-				metrics.IncReplicaQueries()
+				replicaQueries.Inc()
 			}
 
 			if router.IsSessionModification(query) {
@@ -164,83 +370,369 @@ func (s *Session) Run() {
 
 			conn, err := s.getBackendConn(s.extendedDest)
 			if err != nil {
-				log.Printf("failed to get backend connection for Parse: %v", err)
+				s.log.Error("failed to get backend connection for Parse", "destination", s.extendedDest.String(), "err", err)
+				s.sendBackendError(err)
 				return
 			}
+			if s.req.sent.IsZero() {
+				s.req.sent = time.Now()
+			}
 			if _, err := conn.Write(append([]byte{msgType}, append(buf[1:5], msgBody...)...)); err != nil {
-				log.Printf("error forwarding Parse to backend: %v", err)
+				s.log.Error("error forwarding Parse to backend", "backend", s.backendAddr(conn), "err", err)
 				return
 			}
 		} else if msgType == config.BindMessage || msgType == config.ExecuteMessage ||
 			msgType == config.DescribeMessage || msgType == config.CloseMessage {
-				// we have to send those message to the same connection as we do the parse message
+			query := s.trackStatement(msgType, msgBody)
+			if s.req == nil && (msgType == config.BindMessage || msgType == config.ExecuteMessage) {
+				// a prepared statement run without a Parse in this request
+				totalQueries.Inc()
+				s.client.Query()
+				s.beginRequest(query)
+			}
+			// we have to send those message to the same connection as we do the parse message
 			conn, err := s.getBackendConn(s.extendedDest)
 			if err != nil {
-				log.Printf("failed to get backend connection: %v", err)
+				s.log.Error("failed to get backend connection", "destination", s.extendedDest.String(), "err", err)
+				s.sendBackendError(err)
 				return
 			}
+			if s.req != nil && s.req.sent.IsZero() {
+				s.req.sent = time.Now()
+			}
 			if _, err := conn.Write(append([]byte{msgType}, append(buf[1:5], msgBody...)...)); err != nil {
-				log.Printf("error forwarding message %c to backend: %v", msgType, err)
+				s.log.Error("error forwarding message to backend", "type", string(msgType), "backend", s.backendAddr(conn), "err", err)
 				return
 			}
 		} else if msgType == config.SyncMessage || msgType == config.FlushMessage {
 			conn, err := s.getBackendConn(s.extendedDest)
 			if err != nil {
-				log.Printf("failed to get backend connection: %v", err)
+				s.log.Error("failed to get backend connection", "destination", s.extendedDest.String(), "err", err)
+				s.sendBackendError(err)
 				return
 			}
 			if _, err := conn.Write(append([]byte{msgType}, append(buf[1:5], msgBody...)...)); err != nil {
-				log.Printf("error forwarding Sync/Flush to backend: %v", err)
+				s.log.Error("error forwarding Sync/Flush to backend", "backend", s.backendAddr(conn), "err", err)
 				return
 			}
 			// Proxy response back
 			if err := s.proxyResponse(conn); err != nil {
-				log.Printf("error proxying response for Sync/Flush: %v", err)
+				s.log.Error("error proxying response for Sync/Flush", "backend", s.backendAddr(conn), "err", err)
 				return
 			}
 		} else if msgType == config.TerminateMessage {
-			log.Println("client terminated connection")
+			s.log.Debug("client terminated connection")
 			return
 		} else {
 			conn, err := s.getBackendConn(router.Primary)
 			if err != nil {
-				log.Printf("failed to get backend RW connection: %v", err)
+				s.log.Error("failed to get backend RW connection", "err", err)
+				s.sendBackendError(err)
 				return
 			}
 			if _, err := conn.Write(append([]byte{msgType}, append(buf[1:5], msgBody...)...)); err != nil {
-				log.Printf("error forwarding message to RW backend: %v", err)
+				s.log.Error("error forwarding message to RW backend", "backend", s.backendAddr(conn), "err", err)
 				return
 			}
 			// We might need to proxy response depending on message type,
 			// but for now let's assume it needs a response if it's not handled above.
 			if err := s.proxyResponse(conn); err != nil {
-				log.Printf("error proxying response from RW: %v", err)
+				s.log.Error("error proxying response from RW", "backend", s.backendAddr(conn), "err", err)
 				return
 			}
 		}
 	}
 }
 
+// endRequestSpan records the backend execution of req and finishes its
+// trace.
+func (s *Session) endRequestSpan(req *request, p *pool.Pool, start time.Time, rows int64, err error, backendFailed bool) {
+	if s.span == req.span {
+		s.span = nil
+	}
+	if req.span == nil {
+		return
+	}
+	exec := req.span.ChildAt("pggate.execute", tracing.KindClient, start)
+	exec.SetAttr("server.address", p.Address())
+	exec.SetAttr("pggate.destination", p.Role())
+	exec.SetAttr("db.rows", rows)
+	if err == nil && backendFailed {
+		err = errors.New("backend error")
+	}
+	exec.SetError(err)
+	exec.End()
+	req.span.SetAttr("pggate.destination", p.Role())
+	req.span.SetAttr("server.address", p.Address())
+	req.span.SetError(err)
+	req.span.End()
+}
+
+// logQuery logs query text when enabled by ProxyConfig.LogQueries.
+func (s *Session) logQuery(msg, query string) {
+	switch s.proxy.config().LogQueries {
+	case "redacted":
+		s.log.Info(msg, "query", stats.Normalize(query))
+	case "full":
+		s.log.Info(msg, "query", query)
+	}
+}
+
+// backendAddr returns the address of the node a session connection belongs
+// to, for logging.
+func (s *Session) backendAddr(conn net.Conn) string {
+	if p := s.poolOf(conn); p != nil {
+		return p.Address()
+	}
+	return ""
+}
+
+// beginRequest starts timing a client request, continuing the client's trace
+// when the query carries a sqlcommenter traceparent.
+func (s *Session) beginRequest(query string) {
+	s.req = &request{received: time.Now(), query: query, stmt: router.ParseStatement(query).Type}
+	s.updateStatus(StateActive)
+	tracer := s.proxy.config().Tracer
+	if tracer == nil {
+		return
+	}
+	parent, _ := tracing.FromQuery(query)
+	span := tracer.StartAt(parent, "pggate.query", tracing.KindServer, s.req.received)
+	sc := s.routingContext()
+	span.SetAttr("db.system", "postgresql")
+	span.SetAttr("db.user", sc.User)
+	span.SetAttr("db.name", sc.Database)
+	span.SetAttr("db.operation", s.req.stmt.String())
+	span.SetAttr("client.address", sc.ClientAddr)
+	span.SetAttr("pggate.session", int64(s.id))
+	s.req.span = span
+	s.span = span
+}
+
+// statementLabel groups statement types for metrics.
+func statementLabel(t router.StatementType) string {
+	switch t {
+	case router.StatementSelect, router.StatementInsert, router.StatementUpdate,
+		router.StatementDelete, router.StatementDDL:
+		return t.String()
+	}
+	return "other"
+}
+
+func (s *Session) route(query string, extended bool) router.Destination {
+	stmt := router.ParseStatement(query)
+	stmt.Extended = extended
+	span := s.span.Child("pggate.route", tracing.KindInternal)
+	d, _ := s.proxy.routing().Decide(stmt, s.routingContext())
+	if d.Destination == router.Replica {
+		s.roGroup = d.Group
+	}
+	span.SetAttr("pggate.destination", d.Destination.String())
+	span.SetAttr("pggate.group", d.Group)
+	span.SetAttr("pggate.reason", d.Reason)
+	span.End()
+	return d.Destination
+}
+
+func (s *Session) routingContext() router.SessionContext {
+	sc := router.SessionContext{
+		User:            s.params["user"],
+		Database:        s.params["database"],
+		ApplicationName: s.params["application_name"],
+		InTransaction:   s.inTransaction,
+		Pinned:          s.hasSessionVariables,
+	}
+	if sc.Database == "" {
+		sc.Database = sc.User
+	}
+	if s.clientConn != nil && s.clientConn.RemoteAddr() != nil {
+		sc.ClientAddr = s.clientConn.RemoteAddr().String()
+	}
+	return sc
+}
+
 func (s *Session) getBackendConn(dest router.Destination) (net.Conn, error) {
 	var err error
 	if dest == router.Primary {
 		if s.backendRWConn == nil {
-			s.backendRWConn, err = s.proxy.poolManager.GetRW()
+			start := time.Now()
+			rw := s.proxy.poolManager.RWPool
+			span := s.span.Child("pggate.acquire", tracing.KindInternal)
+			state := s.waitState()
+			var conn net.Conn
+			conn, err = s.proxy.poolManager.GetRW()
+			s.setBackendConn(&s.backendRWConn, conn)
+			if err == nil {
+				acquireWait.With(rw.Role(), rw.Address()).ObserveDuration(time.Since(start))
+			}
+			span.SetAttr("server.address", rw.Address())
+			span.SetError(err)
+			span.End()
+			s.updateStatus(state)
 		}
 		return s.backendRWConn, err
 	} else {
+		if s.backendROConn != nil && s.backendROGroup != s.roGroup {
+			s.releaseROIfSafe()
+		}
 		if s.backendROConn == nil {
-			s.backendROConn, s.backendROPool, err = s.proxy.poolManager.GetRO()
+			start := time.Now()
+			span := s.span.Child("pggate.acquire", tracing.KindInternal)
+			state := s.waitState()
+			var conn net.Conn
+			conn, s.backendROPool, err = s.proxy.poolManager.GetROPreferred(s.roGroup, s.balanceKey(), s.stickyPool(s.roGroup))
+			s.setBackendConn(&s.backendROConn, conn)
+			s.backendROGroup = s.roGroup
+			if err == nil {
+				s.setStickyPool(s.roGroup, s.backendROPool)
+				acquireWait.With(s.backendROPool.Role(), s.backendROPool.Address()).ObserveDuration(time.Since(start))
+				span.SetAttr("server.address", s.backendROPool.Address())
+			}
+			span.SetAttr("pggate.group", s.roGroup)
+			span.SetError(err)
+			span.End()
+			s.updateStatus(state)
 		}
 		return s.backendROConn, err
 	}
 }
 
+// balanceKey returns the client key configured for hash-based balancing.
+func (s *Session) balanceKey() string {
+	key := s.proxy.config().HashKey
+	switch key {
+	case "":
+		return ""
+	case "client_addr":
+		if s.clientConn == nil || s.clientConn.RemoteAddr() == nil {
+			return ""
+		}
+		addr := s.clientConn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			return host
+		}
+		return addr
+	case "database":
+		return s.routingContext().Database
+	default:
+		return s.params[key]
+	}
+}
+
+// stickyPool returns the replica this session should keep using for group,
+// or nil when stickiness is off or nothing has been chosen yet.
+func (s *Session) stickyPool(group string) *pool.Pool {
+	switch sticky := s.stickyMode(); sticky {
+	case "":
+		return nil
+	case "session":
+		return s.stickyPools[group]
+	default:
+		return s.proxy.stickyGet(group + "\x00" + s.params[sticky])
+	}
+}
+
+func (s *Session) setStickyPool(group string, p *pool.Pool) {
+	switch sticky := s.stickyMode(); sticky {
+	case "":
+	case "session":
+		if s.stickyPools == nil {
+			s.stickyPools = make(map[string]*pool.Pool)
+		}
+		s.stickyPools[group] = p
+	default:
+		s.proxy.stickySet(group+"\x00"+s.params[sticky], p)
+	}
+}
+
+// stickyMode is the configured Sticky, or "session" when the session lacks
+// the attribute it is keyed on, so such sessions do not all share a replica.
+func (s *Session) stickyMode() string {
+	sticky := s.proxy.config().Sticky
+	if sticky != "" && sticky != "session" && s.params[sticky] == "" {
+		return "session"
+	}
+	return sticky
+}
+
+// stickyEntry is the replica remembered for a sticky key.
+type stickyEntry struct {
+	key  string
+	pool *pool.Pool
+}
+
+func (p *Proxy) stickyGet(key string) *pool.Pool {
+	p.stickyMu.Lock()
+	defer p.stickyMu.Unlock()
+	e, ok := p.sticky[key]
+	if !ok {
+		return nil
+	}
+	p.stickyLRU.MoveToFront(e)
+	return e.Value.(*stickyEntry).pool
+}
+
+// stickySet remembers the replica for a sticky key. The keys come from
+// client startup parameters, so only as many as client statistics are kept,
+// forgetting the least recently used.
+func (p *Proxy) stickySet(key string, pl *pool.Pool) {
+	p.stickyMu.Lock()
+	defer p.stickyMu.Unlock()
+	if e, ok := p.sticky[key]; ok {
+		e.Value.(*stickyEntry).pool = pl
+		p.stickyLRU.MoveToFront(e)
+		return
+	}
+	limit := cmp.Or(p.config().MaxClientStats, stats.DefaultMaxClients)
+	for len(p.sticky) >= limit {
+		oldest := p.stickyLRU.Back()
+		delete(p.sticky, oldest.Value.(*stickyEntry).key)
+		p.stickyLRU.Remove(oldest)
+	}
+	p.sticky[key] = p.stickyLRU.PushFront(&stickyEntry{key: key, pool: pl})
+}
+
+// retired is called when a replica pool is taken out of rotation. It drops
+// the pool from the sticky replicas and takes its connections back from idle
+// sessions, so draining it does not wait for their next query.
+func (p *Proxy) retired(pl *pool.Pool) {
+	p.forgetPool(pl)
+	p.releaseIdleReplicas(func(rp *pool.Pool) bool { return rp == pl })
+}
+
+// forgetPool drops the sticky keys of a replica taken out of rotation.
+func (p *Proxy) forgetPool(pl *pool.Pool) {
+	p.stickyMu.Lock()
+	defer p.stickyMu.Unlock()
+	for e := p.stickyLRU.Front(); e != nil; {
+		next := e.Next()
+		if entry := e.Value.(*stickyEntry); entry.pool == pl {
+			delete(p.sticky, entry.key)
+			p.stickyLRU.Remove(e)
+		}
+		e = next
+	}
+}
+
+// poolOf returns the pool a session backend connection was taken from.
+func (s *Session) poolOf(conn net.Conn) *pool.Pool {
+	switch conn {
+	case nil:
+		return nil
+	case s.backendRWConn:
+		return s.proxy.poolManager.RWPool
+	case s.backendROConn:
+		return s.backendROPool
+	}
+	return nil
+}
+
 func (s *Session) releaseROIfSafe() {
 	if s.backendROConn != nil {
 		s.proxy.poolManager.PutRO(s.backendROConn, s.backendROPool)
-		s.backendROConn = nil
+		s.setBackendConn(&s.backendROConn, nil)
 		s.backendROPool = nil
+		s.updateStatus("")
 	}
 }
 
@@ -275,32 +767,84 @@ func (s *Session) extractQueryFromParse(msgBody []byte) string {
 	return string(msgBody[i:j])
 }
 
-func (s *Session) proxyResponse(backendConn net.Conn) error {
+// proxyResponse relays backend messages to the client until ReadyForQuery
+// and records the round trip against the backend's pool health.
+func (s *Session) proxyResponse(backendConn net.Conn) (err error) {
+	start := time.Now()
+	req := s.req
+	s.req = nil
+	if req != nil && !req.sent.IsZero() {
+		start = req.sent
+	}
+	var firstByte time.Time
+	// authentication waits on the client, so its timing says nothing about the backend
+	measured := true
+	backendFailed := false
+	var rows int64
+	defer func() {
+		p := s.poolOf(backendConn)
+		if p == nil {
+			return
+		}
+		if measured || backendFailed {
+			p.Observe(time.Since(start), backendFailed)
+		}
+		if req != nil {
+			s.endRequestSpan(req, p, start, rows, err, backendFailed)
+		}
+		if req != nil && err == nil {
+			s.client.Spent(time.Since(req.received))
+			s.proxy.queries.Record(req.query, p.Role(), p.Address(), time.Since(req.received), rows)
+			s.logSlowQuery(req, p, rows)
+			stmt := statementLabel(req.stmt)
+			queryDuration.With(p.Role(), p.Address(), stmt).ObserveDuration(time.Since(req.received))
+			queryFirstByte.With(p.Role(), p.Address(), stmt).ObserveDuration(firstByte.Sub(start))
+		}
+	}()
+
 	buf := make([]byte, 8192)
 	for {
 		if _, err := io.ReadFull(backendConn, buf[:1]); err != nil {
+			backendFailed = true
 			return err
 		}
+		if firstByte.IsZero() {
+			firstByte = time.Now()
+		}
 		msgType := buf[0]
 
 		if _, err := io.ReadFull(backendConn, buf[1:5]); err != nil {
+			backendFailed = true
 			return err
 		}
 		length := int32(binary.BigEndian.Uint32(buf[1:5]))
 
 		body := make([]byte, length-4)
 		if _, err := io.ReadFull(backendConn, body); err != nil {
+			backendFailed = true
 			return err
 		}
 
 		if _, err := s.clientConn.Write(append([]byte{msgType}, append(buf[1:5], body...)...)); err != nil {
 			return err
 		}
+		s.client.Sent(5 + len(body))
+
+		if msgType == config.CommandComplete {
+			rows += commandRows(body)
+		}
+		if msgType == config.ErrorResponse {
+			s.client.Error()
+			if isBackendFailure(errorCode(body)) {
+				backendFailed = true
+			}
+		}
 
 		// Handle Authentication Request
 		if msgType == config.Authentification {
 			authType := binary.BigEndian.Uint32(body[:4])
 			if authType != 0 {
+				measured = false
 				// We need a response from the client (e.g., PasswordMessage)
 				if err := s.handleAuthResponse(backendConn); err != nil {
 					return err
@@ -316,6 +860,69 @@ func (s *Session) proxyResponse(backendConn net.Conn) error {
 	}
 }
 
+func (s *Session) logSlowQuery(req *request, p *pool.Pool, rows int64) {
+	d := time.Since(req.received)
+	slowLog := s.proxy.config().SlowLog
+	if !slowLog.Slow(d) {
+		return
+	}
+	sc := s.routingContext()
+	err := slowLog.Log(slowlog.Entry{
+		Duration:        d,
+		Query:           req.query,
+		Destination:     p.Role(),
+		Backend:         p.Address(),
+		User:            sc.User,
+		Database:        sc.Database,
+		ApplicationName: sc.ApplicationName,
+		ClientAddr:      sc.ClientAddr,
+		Rows:            rows,
+	})
+	if err != nil {
+		s.log.Error("error writing slow query log", "err", err)
+	}
+}
+
+// commandRows returns the row count of a CommandComplete tag such as
+// "SELECT 5" or "INSERT 0 3", or 0 for commands without one.
+func commandRows(body []byte) int64 {
+	tag := string(bytes.TrimRight(body, "\x00"))
+	i := strings.LastIndexByte(tag, ' ')
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.ParseInt(tag[i+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// errorCode returns the SQLSTATE field of an ErrorResponse body.
+func errorCode(body []byte) string {
+	for _, field := range bytes.Split(body, []byte{0}) {
+		if len(field) > 1 && field[0] == 'C' {
+			return string(field[1:])
+		}
+	}
+	return ""
+}
+
+// isBackendFailure reports whether a SQLSTATE points at the server rather
+// than the query: connection exceptions, insufficient resources, operator
+// intervention, system and internal errors. A cancelled query is not a
+// server problem.
+func isBackendFailure(code string) bool {
+	if len(code) < 2 || code == "57014" {
+		return false
+	}
+	switch code[:2] {
+	case "08", "53", "57", "58", "XX":
+		return true
+	}
+	return false
+}
+
 func (s *Session) handleAuthResponse(backendConn net.Conn) error {
 	buf := make([]byte, 8192)
 	// Read message type from client
@@ -334,6 +941,7 @@ func (s *Session) handleAuthResponse(backendConn net.Conn) error {
 	if _, err := io.ReadFull(s.clientConn, body); err != nil {
 		return err
 	}
+	s.client.Received(5 + len(body))
 
 	// Forward to backend
 	if _, err := backendConn.Write(append([]byte{msgType}, append(buf[1:5], body...)...)); err != nil {
@@ -344,6 +952,18 @@ func (s *Session) handleAuthResponse(backendConn net.Conn) error {
 }
 
 func (s *Session) Cleanup() {
+	if s.req != nil && s.req.span != nil {
+		s.req.span.SetError(errors.New("session ended before the query completed"))
+		s.req.span.End()
+	}
+	select {
+	case <-s.killed:
+		// kill closed the backend connections
+		s.proxy.poolManager.DiscardRW(s.backendRWConn)
+		s.proxy.poolManager.DiscardRO(s.backendROConn, s.backendROPool)
+		return
+	default:
+	}
 	if s.backendRWConn != nil {
 		s.proxy.poolManager.PutRW(s.backendRWConn)
 	}
@@ -352,6 +972,58 @@ func (s *Session) Cleanup() {
 	}
 }
 
+// sendBackendError tells the client why no backend connection could be
+// obtained before the session is closed.
+func (s *Session) sendBackendError(err error) {
+	code, msg := "08006", "could not connect to backend server"
+	if errors.Is(err, pool.ErrAcquireTimeout) {
+		code, msg = "53300", "timed out waiting for a free backend connection"
+	}
+	if werr := s.sendError("FATAL", code, msg); werr != nil {
+		s.log.Warn("error sending ErrorResponse to client", "err", werr)
+	}
+}
+
+// sendError writes an ErrorResponse with the given severity, SQLSTATE and
+// message to the client.
+func (s *Session) sendError(severity, code, message string) error {
+	errorsSent.Inc()
+	var body []byte
+	for _, f := range []struct {
+		typ byte
+		val string
+	}{{'S', severity}, {'V', severity}, {'C', code}, {'M', message}} {
+		body = append(body, f.typ)
+		body = append(body, f.val...)
+		body = append(body, 0)
+	}
+	body = append(body, 0)
+
+	msg := make([]byte, 5, 5+len(body))
+	msg[0] = config.ErrorResponse
+	binary.BigEndian.PutUint32(msg[1:5], uint32(4+len(body)))
+	s.client.Error()
+	s.client.Sent(len(msg) + len(body))
+	_, err := s.clientConn.Write(append(msg, body...))
+	return err
+}
+
+// parseStartupParams extracts the key/value pairs of a StartupMessage.
+func parseStartupParams(msg []byte) map[string]string {
+	params := make(map[string]string)
+	if len(msg) < 8 {
+		return params
+	}
+	fields := bytes.Split(msg[8:], []byte{0})
+	for i := 0; i+1 < len(fields); i += 2 {
+		if len(fields[i]) == 0 {
+			break
+		}
+		params[string(fields[i])] = string(fields[i+1])
+	}
+	return params
+}
+
 func HandleHandshake(clientConn net.Conn) ([]byte, error) {
 	buf := make([]byte, 8)
 	if _, err := io.ReadFull(clientConn, buf[:4]); err != nil {
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/user/pggate/internal/config"
+)
+
+// The test replica is unreachable, so a query routed to it fails while the
+// fake primary answers.
+func TestSession_CommentedTransactionAndSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		queries []string
+		primary bool // the SELECT that follows goes to the primary
+	}{
+		{"begin", []string{"/* app */ BEGIN"}, true},
+		{"set", []string{"/* app */ SET search_path TO app"}, true},
+		{"commit", []string{"/* app */ BEGIN", "-- app\nCOMMIT"}, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t, AdminConfig{})
+			client, _ := runTestSession(p, uint64(i+1), false, fakeBackend(t))
+			defer client.Close()
+			for _, q := range tt.queries {
+				if msgs := simpleQuery(t, client, q); msgs[0].typ == config.ErrorResponse {
+					t.Fatalf("%q failed: %q", q, msgs[0].body)
+				}
+			}
+			msgs := simpleQuery(t, client, "/* app */ SELECT 1")
+			if got := msgs[0].typ != config.ErrorResponse; got != tt.primary {
+				t.Errorf("SELECT after %q sent to the primary = %v, want %v", tt.queries, got, tt.primary)
+			}
+		})
+	}
+}
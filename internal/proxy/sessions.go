@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"cmp"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/user/pggate/internal/pool"
+)
+
+// Session states as reported by SessionInfo.
+const (
+	StateIdle           = "idle"
+	StateActive         = "active"
+	StateIdleInTx       = "idle in transaction"
+	StateAuthenticating = "authenticating"
+	StateWaiting        = "waiting" // held by Pause
+)
+
+// SessionInfo is a snapshot of a client session for the admin interfaces.
+type SessionInfo struct {
+	ID              uint64    `json:"id"`
+	User            string    `json:"user"`
+	Database        string    `json:"database"`
+	ApplicationName string    `json:"application_name"`
+	ClientAddr      string    `json:"client_addr"`
+	ConnectedAt     time.Time `json:"connected_at"`
+	State           string    `json:"state"`
+	InTransaction   bool      `json:"in_transaction"`
+	Pinned          bool      `json:"pinned"` // session variables pin it to the primary
+	Primary         string    `json:"primary,omitempty"`
+	PrimaryLocal    string    `json:"primary_local_addr,omitempty"`
+	Replica         string    `json:"replica,omitempty"`
+	ReplicaLocal    string    `json:"replica_local_addr,omitempty"`
+	ReplicaGroup    string    `json:"replica_group,omitempty"`
+}
+
+// Sessions lists the connected client sessions by id.
+func (p *Proxy) Sessions() []SessionInfo {
+	p.sessionsMu.Lock()
+	out := make([]SessionInfo, 0, len(p.sessions))
+	for _, s := range p.sessions {
+		out = append(out, s.Info())
+	}
+	p.sessionsMu.Unlock()
+	slices.SortFunc(out, func(a, b SessionInfo) int { return cmp.Compare(a.ID, b.ID) })
+	return out
+}
+
+// KillSession closes the client connection of a session, which ends it and
+// returns its backend connections. It reports whether the session existed.
+func (p *Proxy) KillSession(id uint64) bool {
+	p.sessionsMu.Lock()
+	s, ok := p.sessions[id]
+	p.sessionsMu.Unlock()
+	if !ok {
+		return false
+	}
+	s.log.Info("session killed by administrator")
+	s.kill()
+	return true
+}
+
+// kill closes the client and backend connections, so the session ends even
+// while it waits on a backend, and wakes it if Pause is holding it.
+func (s *Session) kill() {
+	s.killOnce.Do(func() {
+		close(s.killed)
+		s.clientConn.Close()
+		s.backendMu.Lock()
+		defer s.backendMu.Unlock()
+		for _, conn := range []net.Conn{s.backendRWConn, s.backendROConn} {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	})
+}
+
+// setBackendConn stores a backend connection of the session where kill
+// finds it, closing it right away if the session was killed meanwhile.
+func (s *Session) setBackendConn(field *net.Conn, conn net.Conn) {
+	s.backendMu.Lock()
+	defer s.backendMu.Unlock()
+	*field = conn
+	select {
+	case <-s.killed:
+		if conn != nil {
+			conn.Close()
+		}
+	default:
+	}
+}
+
+// setIdle marks whether the session is waiting for a client message between
+// transactions. While it is, releaseIdleRO may return its replica connection
+// from another goroutine.
+func (s *Session) setIdle(idle bool) {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	s.idleRead.Store(idle)
+}
+
+// releaseIdleRO returns the replica connection of an idle session if release
+// selects its pool.
+func (s *Session) releaseIdleRO(release func(*pool.Pool) bool) {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	if s.idleRead.Load() && s.backendROPool != nil && release(s.backendROPool) {
+		s.log.Debug("returning the replica connection of an idle session", "backend", s.backendROPool.Address())
+		s.releaseROIfSafe()
+	}
+}
+
+// releaseIdleReplicas returns the replica connections that idle sessions
+// hold on the pools release selects.
+func (p *Proxy) releaseIdleReplicas(release func(*pool.Pool) bool) {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+	for _, s := range p.sessions {
+		s.releaseIdleRO(release)
+	}
+}
+
+func (p *Proxy) addSession(s *Session) {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+	p.sessions[s.id] = s
+}
+
+func (p *Proxy) removeSession(s *Session) {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+	delete(p.sessions, s.id)
+}
+
+func (s *Session) Info() SessionInfo {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	return s.status
+}
+
+// updateStatus publishes the session state for Info; an empty state keeps
+// the current one. It is called by the session goroutine whenever the state
+// may have changed.
+func (s *Session) updateStatus(state string) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	if state == StateIdle && s.inTransaction {
+		state = StateIdleInTx
+	}
+	st := &s.status
+	if state != "" {
+		st.State = state
+	}
+	st.InTransaction = s.inTransaction
+	st.Pinned = s.hasSessionVariables
+	st.Primary, st.PrimaryLocal = "", ""
+	if s.backendRWConn != nil {
+		st.Primary = s.proxy.poolManager.RWPool.Address()
+		st.PrimaryLocal = s.backendRWConn.LocalAddr().String()
+	}
+	st.Replica, st.ReplicaLocal, st.ReplicaGroup = "", "", ""
+	if s.backendROConn != nil && s.backendROPool != nil {
+		st.Replica = s.backendROPool.Address()
+		st.ReplicaLocal = s.backendROConn.LocalAddr().String()
+		st.ReplicaGroup = s.backendROGroup
+	}
+}
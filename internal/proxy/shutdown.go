@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	shutdownPollInterval = 10 * time.Millisecond
+	// shutdownWriteTimeout bounds sending the shutdown error to a client.
+	shutdownWriteTimeout = time.Second
+)
+
+// Shutdown ends every client session. Sessions between transactions get a
+// 57P01 admin_shutdown error and are closed right away; sessions in a
+// transaction keep running until it ends. When ctx is done first, the
+// remaining sessions are killed along with their backend connections, a
+// pause is lifted so none stays queued in a pool, and an error wrapping
+// ctx.Err() is returned.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	p.shuttingDown.Store(true)
+	p.sessionsMu.Lock()
+	slog.Info("closing client sessions", "sessions", len(p.sessions))
+	for _, s := range p.sessions {
+		if s.idleRead.Load() {
+			// wake the session from reading its next query
+			_ = s.clientConn.SetReadDeadline(time.Now())
+		}
+	}
+	p.sessionsMu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		p.sessionsMu.Lock()
+		remaining := make([]*Session, 0, len(p.sessions))
+		for _, s := range p.sessions {
+			remaining = append(remaining, s)
+		}
+		p.sessionsMu.Unlock()
+		if len(remaining) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			for _, s := range remaining {
+				s.log.Warn("session killed by shutdown", "state", s.Info().State)
+				s.kill()
+			}
+			// sessions queued on a paused pool get a connection and find
+			// themselves killed
+			p.Resume()
+			return fmt.Errorf("%d sessions still open: %w", len(remaining), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// ShuttingDown reports whether Shutdown was called.
+func (p *Proxy) ShuttingDown() bool {
+	return p.shuttingDown.Load()
+}
+
+// shutdownIdle is called before reading the next client message. Between
+// transactions it marks the session for Shutdown to wake, and ends it if
+// Shutdown was called already.
+func (s *Session) shutdownIdle() bool {
+	if s.req != nil || s.inTransaction {
+		return false
+	}
+	s.setIdle(true)
+	if !s.proxy.ShuttingDown() {
+		return false
+	}
+	s.setIdle(false)
+	s.sendShutdown()
+	return true
+}
+
+// shutdownInterrupted reports whether a failed client read was woken by
+// Shutdown, and tells the client so.
+func (s *Session) shutdownInterrupted(err error) bool {
+	if !s.proxy.ShuttingDown() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+	s.sendShutdown()
+	return true
+}
+
+// sendShutdown tells the client the proxy is going away, as Postgres does on
+// a fast shutdown.
+func (s *Session) sendShutdown() {
+	s.log.Debug("session closed by shutdown")
+	_ = s.clientConn.SetWriteDeadline(time.Now().Add(shutdownWriteTimeout))
+	if err := s.sendError("FATAL", "57P01", "terminating connection due to administrator command"); err != nil {
+		s.log.Debug("error sending shutdown notice", "err", err)
+	}
+}
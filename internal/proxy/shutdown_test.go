@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/config"
+	"github.com/user/pggate/internal/stats"
+)
+
+// runTestSession serves a session over a pipe like HandleClient does after
+// authentication and returns the client end. A non-nil backend is used as
+// the session's primary connection.
+func runTestSession(p *Proxy, id uint64, inTx bool, backend net.Conn) (net.Conn, *Session) {
+	client, server := net.Pipe()
+	s := &Session{
+		id:            id,
+		clientConn:    server,
+		backendRWConn: backend,
+		proxy:         p,
+		log:           slog.Default(),
+		killed:        make(chan struct{}),
+		client:        p.clients.For(stats.ClientKey{}),
+	}
+	s.inTransaction = inTx
+	p.addSession(s)
+	go func() {
+		defer p.removeSession(s)
+		defer server.Close()
+		s.Run()
+	}()
+	return client, s
+}
+
+func TestProxy_Shutdown(t *testing.T) {
+	p := newTestProxy(t, AdminConfig{})
+	idle, idleSession := runTestSession(p, 1, false, nil)
+	inTx, _ := runTestSession(p, 2, true, nil)
+	for deadline := time.Now().Add(time.Second); !idleSession.idleRead.Load(); {
+		if time.Now().After(deadline) {
+			t.Fatal("session never waited for a query")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- p.Shutdown(ctx) }()
+
+	// the idle session is told right away
+	msg := readMessage(t, idle)
+	if msg.typ != config.ErrorResponse || !strings.Contains(string(msg.body), "C57P01\x00") {
+		t.Errorf("idle session got %c %q, want ErrorResponse 57P01", msg.typ, msg.body)
+	}
+	if _, err := idle.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("idle session read after the notice error = %v, want EOF", err)
+	}
+
+	// the session in a transaction is killed when the timeout expires
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown() did not return after its timeout")
+	}
+	if _, err := inTx.Read(make([]byte, 1)); err == nil {
+		t.Error("session in a transaction still open after Shutdown()")
+	}
+	for deadline := time.Now().Add(time.Second); len(p.Sessions()) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("killed sessions still running: %+v", p.Sessions())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !p.ShuttingDown() {
+		t.Error("ShuttingDown() = false after Shutdown()")
+	}
+
+	// sessions reaching the end of a transaction later are closed too
+	late, _ := runTestSession(p, 3, false, nil)
+	msg = readMessage(t, late)
+	if msg.typ != config.ErrorResponse || !strings.Contains(string(msg.body), "C57P01\x00") {
+		t.Errorf("session after Shutdown() got %c %q, want ErrorResponse 57P01", msg.typ, msg.body)
+	}
+}
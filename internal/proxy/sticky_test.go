@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/user/pggate/internal/pool"
+	"github.com/user/pggate/internal/router"
+)
+
+func TestProxy_Sticky(t *testing.T) {
+	pm := pool.NewPoolManager("127.0.0.1:1", nil, 1, 1, time.Minute)
+	defer pm.Close()
+	p := NewProxy(ProxyConfig{MaxClientStats: 2}, pm, router.NewRouter())
+	a, b := pool.NewPool("127.0.0.1:2", 1, 0), pool.NewPool("127.0.0.1:3", 1, 0)
+	defer a.Close()
+	defer b.Close()
+
+	p.stickySet("alice", a)
+	p.stickySet("bob", b)
+	p.stickyGet("alice")
+	// at the limit the least recently used key is forgotten
+	p.stickySet("carol", a)
+	tests := []struct {
+		key  string
+		want *pool.Pool
+	}{
+		{"alice", a},
+		{"bob", nil},
+		{"carol", a},
+	}
+	for _, tt := range tests {
+		if got := p.stickyGet(tt.key); got != tt.want {
+			t.Errorf("stickyGet(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	p.stickySet("bob", b)
+	p.forgetPool(a)
+	if p.stickyGet("alice") != nil || p.stickyGet("carol") != nil || p.stickyGet("bob") != b {
+		t.Error("forgetPool() did not drop exactly the keys of the retired pool")
+	}
+	if len(p.sticky) != p.stickyLRU.Len() {
+		t.Errorf("sticky map has %d keys and the LRU list %d", len(p.sticky), p.stickyLRU.Len())
+	}
+}
+
+func TestSession_StickyWithoutKey(t *testing.T) {
+	pm := pool.NewPoolManager("127.0.0.1:1", nil, 1, 1, time.Minute)
+	defer pm.Close()
+	p := NewProxy(ProxyConfig{Sticky: "application_name"}, pm, router.NewRouter())
+	a, b := pool.NewPool("127.0.0.1:2", 1, 0), pool.NewPool("127.0.0.1:3", 1, 0)
+	defer a.Close()
+	defer b.Close()
+
+	named1 := &Session{proxy: p, params: map[string]string{"application_name": "app"}}
+	named2 := &Session{proxy: p, params: map[string]string{"application_name": "app"}}
+	anon1 := &Session{proxy: p, params: map[string]string{}}
+	anon2 := &Session{proxy: p, params: map[string]string{"application_name": ""}}
+
+	named1.setStickyPool("", a)
+	anon1.setStickyPool("", b)
+	if got := named2.stickyPool(""); got != a {
+		t.Errorf("stickyPool() of a session with the same application_name = %v, want %v", got, a)
+	}
+	if got := anon1.stickyPool(""); got != b {
+		t.Errorf("stickyPool() of a session without application_name = %v, want its own %v", got, b)
+	}
+	if got := anon2.stickyPool(""); got != nil {
+		t.Errorf("stickyPool() of another session without application_name = %v, want nil", got)
+	}
+	if len(p.sticky) != 1 {
+		t.Errorf("%d shared sticky keys, want only the application_name one", len(p.sticky))
+	}
+}
@@ -23,7 +23,7 @@ func (r *Router) Route(query string, inTransaction bool) Destination {
 		return Primary
 	}
 
-	query = strings.TrimSpace(strings.ToUpper(query))
+	query = strings.TrimSpace(strings.ToUpper(StripLeadingComments(query)))
 
 	if strings.HasPrefix(query, "INSERT") ||
 		strings.HasPrefix(query, "UPDATE") ||
@@ -57,17 +57,41 @@ func (r *Router) Route(query string, inTransaction bool) Destination {
 	return Primary
 }
 
+// StripLeadingComments removes SQL comments that precede the statement,
+// such as sqlcommenter or routing hints.
+func StripLeadingComments(query string) string {
+	for {
+		query = strings.TrimSpace(query)
+		switch {
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		case strings.HasPrefix(query, "--"):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		default:
+			return query
+		}
+	}
+}
+
 func IsSessionModification(query string) bool {
-	query = strings.TrimSpace(strings.ToUpper(query))
+	query = strings.ToUpper(StripLeadingComments(query))
 	return strings.HasPrefix(query, "SET") || strings.HasPrefix(query, "RESET")
 }
 
 func IsTransactionStart(query string) bool {
-	query = strings.TrimSpace(strings.ToUpper(query))
+	query = strings.ToUpper(StripLeadingComments(query))
 	return strings.HasPrefix(query, "BEGIN") || strings.HasPrefix(query, "START TRANSACTION")
 }
 
 func IsTransactionEnd(query string) bool {
-	query = strings.TrimSpace(strings.ToUpper(query))
+	query = strings.ToUpper(StripLeadingComments(query))
 	return strings.HasPrefix(query, "COMMIT") || strings.HasPrefix(query, "ROLLBACK") || strings.HasPrefix(query, "ABORT")
 }
@@ -87,6 +87,8 @@ func TestIsTransactionStart(t *testing.T) {
 		{"START TRANSACTION", true},
 		{"SELECT 1", false},
 		{"  begin  ", true},
+		{"/* app */ BEGIN", true},
+		{"-- app\nSTART TRANSACTION", true},
 	}
 
 	for _, tt := range tests {
@@ -104,6 +106,7 @@ func TestIsTransactionEnd(t *testing.T) {
 		{"COMMIT", true},
 		{"ROLLBACK", true},
 		{"ABORT", true},
+		{"/* app */ COMMIT", true},
 		{"SELECT 1", false},
 	}
 
@@ -121,6 +124,7 @@ func TestIsSessionModification(t *testing.T) {
 	}{
 		{"SET search_path TO myschema", true},
 		{"RESET ALL", true},
+		{"/* app */ SET search_path TO myschema", true},
 		{"SELECT 1", false},
 	}
 
@@ -130,3 +134,22 @@ func TestIsSessionModification(t *testing.T) {
 		}
 	}
 }
+
+func TestStripLeadingComments(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"/* app=web */ SELECT 1", "SELECT 1"},
+		{"-- note\nSELECT 1", "SELECT 1"},
+		{"/* a */ /* b */\n  INSERT INTO t VALUES (1)", "INSERT INTO t VALUES (1)"},
+		{"SELECT 1 /* trailing */", "SELECT 1 /* trailing */"},
+		{"/* unterminated", ""},
+	}
+
+	for _, tt := range tests {
+		if got := StripLeadingComments(tt.query); got != tt.expected {
+			t.Errorf("StripLeadingComments(%q) = %q, want %q", tt.query, got, tt.expected)
+		}
+	}
+}
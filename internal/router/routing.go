@@ -0,0 +1,157 @@
+package router
+
+import "strings"
+
+type StatementType int
+
+const (
+	StatementOther StatementType = iota
+	StatementSelect
+	StatementInsert
+	StatementUpdate
+	StatementDelete
+	StatementDDL
+	StatementTransaction
+	StatementSession
+	StatementShow
+)
+
+func (t StatementType) String() string {
+	switch t {
+	case StatementSelect:
+		return "select"
+	case StatementInsert:
+		return "insert"
+	case StatementUpdate:
+		return "update"
+	case StatementDelete:
+		return "delete"
+	case StatementDDL:
+		return "ddl"
+	case StatementTransaction:
+		return "transaction"
+	case StatementSession:
+		return "session"
+	case StatementShow:
+		return "show"
+	default:
+		return "other"
+	}
+}
+
+func (d Destination) String() string {
+	if d == Replica {
+		return "replica"
+	}
+	return "primary"
+}
+
+// Statement is a client query as seen by a Routing implementation.
+type Statement struct {
+	Query    string
+	Type     StatementType
+	Extended bool // came from a Parse message rather than a simple Query
+}
+
+// ParseStatement classifies query by its leading keyword.
+func ParseStatement(query string) Statement {
+	return Statement{Query: query, Type: classify(query)}
+}
+
+func classify(query string) StatementType {
+	q := strings.ToUpper(StripLeadingComments(query))
+	keyword := q
+	if i := strings.IndexAny(q, " \t\r\n(;"); i >= 0 {
+		keyword = q[:i]
+	}
+	switch keyword {
+	case "SELECT", "VALUES", "TABLE":
+		return StatementSelect
+	case "WITH":
+		if strings.Contains(q, "INSERT") || strings.Contains(q, "UPDATE") || strings.Contains(q, "DELETE") {
+			return StatementOther
+		}
+		return StatementSelect
+	case "INSERT", "COPY":
+		return StatementInsert
+	case "UPDATE":
+		return StatementUpdate
+	case "DELETE", "TRUNCATE":
+		return StatementDelete
+	case "CREATE", "DROP", "ALTER", "COMMENT", "GRANT", "REVOKE":
+		return StatementDDL
+	case "BEGIN", "START", "COMMIT", "ROLLBACK", "ABORT", "END", "SAVEPOINT", "RELEASE":
+		return StatementTransaction
+	case "SET", "RESET", "DISCARD":
+		return StatementSession
+	case "SHOW":
+		return StatementShow
+	}
+	return StatementOther
+}
+
+// SessionContext carries the client session state relevant to routing.
+type SessionContext struct {
+	User            string
+	Database        string
+	ApplicationName string
+	ClientAddr      string
+	InTransaction   bool
+	Pinned          bool // session variables were modified, stay on primary
+}
+
+// Decision is the outcome of routing a statement. Group names the replica
+// group to use when Destination is Replica; empty means the default replicas.
+type Decision struct {
+	Destination Destination
+	Group       string
+	Reason      string
+	Metadata    map[string]string
+}
+
+// Routing decides where a statement runs. ok is false when the
+// implementation has no opinion and the next router in a Chain should decide.
+type Routing interface {
+	Decide(stmt Statement, sc SessionContext) (d Decision, ok bool)
+}
+
+// RoutingFunc adapts a plain function to the Routing interface.
+type RoutingFunc func(stmt Statement, sc SessionContext) (Decision, bool)
+
+func (f RoutingFunc) Decide(stmt Statement, sc SessionContext) (Decision, bool) {
+	return f(stmt, sc)
+}
+
+// Chain asks each router in turn and returns the first decision made.
+// If nobody decides the statement goes to the primary.
+type Chain struct {
+	routers []Routing
+}
+
+func NewChain(routers ...Routing) *Chain {
+	return &Chain{routers: routers}
+}
+
+func (c *Chain) Decide(stmt Statement, sc SessionContext) (Decision, bool) {
+	for _, r := range c.routers {
+		if d, ok := r.Decide(stmt, sc); ok {
+			return d, true
+		}
+	}
+	return Decision{Destination: Primary, Reason: "default"}, true
+}
+
+// Decide implements Routing using the keyword heuristics of Route.
+func (r *Router) Decide(stmt Statement, sc SessionContext) (Decision, bool) {
+	switch {
+	case sc.InTransaction:
+		return Decision{Destination: Primary, Reason: "in transaction"}, true
+	case sc.Pinned:
+		return Decision{Destination: Primary, Reason: "session pinned"}, true
+	}
+	dest := r.Route(stmt.Query, false)
+	if dest == Replica {
+		return Decision{Destination: Replica, Reason: "read-only statement"}, true
+	}
+	return Decision{Destination: Primary, Reason: "write or unknown statement"}, true
+}
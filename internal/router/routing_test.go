@@ -0,0 +1,84 @@
+package router
+
+import (
+	"testing"
+)
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected StatementType
+	}{
+		{"SELECT 1", StatementSelect},
+		{"  select * from users", StatementSelect},
+		{"WITH a AS (SELECT 1) SELECT * FROM a", StatementSelect},
+		{"WITH a AS (DELETE FROM t RETURNING *) SELECT * FROM a", StatementOther},
+		{"INSERT INTO users VALUES (1)", StatementInsert},
+		{"UPDATE users SET name = 'x'", StatementUpdate},
+		{"DELETE FROM users", StatementDelete},
+		{"CREATE TABLE t (id int)", StatementDDL},
+		{"BEGIN", StatementTransaction},
+		{"SET search_path TO app", StatementSession},
+		{"SHOW max_connections", StatementShow},
+		{"VACUUM", StatementOther},
+	}
+
+	for _, tt := range tests {
+		if got := ParseStatement(tt.query).Type; got != tt.expected {
+			t.Errorf("ParseStatement(%q).Type = %v, want %v", tt.query, got, tt.expected)
+		}
+	}
+}
+
+func TestRouter_Decide(t *testing.T) {
+	r := NewRouter()
+
+	tests := []struct {
+		name     string
+		query    string
+		sc       SessionContext
+		expected Destination
+	}{
+		{"SELECT", "SELECT 1", SessionContext{}, Replica},
+		{"INSERT", "INSERT INTO t VALUES (1)", SessionContext{}, Primary},
+		{"SELECT in transaction", "SELECT 1", SessionContext{InTransaction: true}, Primary},
+		{"SELECT pinned", "SELECT 1", SessionContext{Pinned: true}, Primary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := r.Decide(ParseStatement(tt.query), tt.sc)
+			if !ok {
+				t.Fatal("Router.Decide() ok = false, want true")
+			}
+			if d.Destination != tt.expected {
+				t.Errorf("Router.Decide() = %v, want %v", d.Destination, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChain_Decide(t *testing.T) {
+	reporting := RoutingFunc(func(stmt Statement, sc SessionContext) (Decision, bool) {
+		if sc.ApplicationName == "reporting" {
+			return Decision{Destination: Replica, Reason: "reporting app"}, true
+		}
+		return Decision{}, false
+	})
+	c := NewChain(reporting, NewRouter())
+
+	d, _ := c.Decide(ParseStatement("SELECT 1"), SessionContext{ApplicationName: "reporting", Pinned: true})
+	if d.Destination != Replica || d.Reason != "reporting app" {
+		t.Errorf("Chain.Decide() = %+v, want replica from custom router", d)
+	}
+
+	d, _ = c.Decide(ParseStatement("SELECT 1"), SessionContext{Pinned: true})
+	if d.Destination != Primary {
+		t.Errorf("Chain.Decide() = %v, want %v from fallback router", d.Destination, Primary)
+	}
+
+	d, _ = NewChain().Decide(ParseStatement("SELECT 1"), SessionContext{})
+	if d.Destination != Primary {
+		t.Errorf("empty Chain.Decide() = %v, want %v", d.Destination, Primary)
+	}
+}
@@ -0,0 +1,86 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var groupHint = regexp.MustCompile(`/\*[^*]*pggate:group=([A-Za-z0-9_.-]+)[^*]*\*/`)
+
+// GroupHint returns the replica group requested by a query comment of the
+// form /* pggate:group=analytics */.
+func GroupHint(query string) (string, bool) {
+	m := groupHint.FindStringSubmatch(query)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Rule targets a replica group. Empty fields match anything.
+type Rule struct {
+	Group           string
+	User            string
+	Database        string
+	ApplicationName string
+	Query           string // regular expression
+
+	pattern *regexp.Regexp
+}
+
+func (r *Rule) matches(stmt Statement, sc SessionContext) bool {
+	if r.User != "" && r.User != sc.User {
+		return false
+	}
+	if r.Database != "" && r.Database != sc.Database {
+		return false
+	}
+	if r.ApplicationName != "" && r.ApplicationName != sc.ApplicationName {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(stmt.Query) {
+		return false
+	}
+	return true
+}
+
+// RuleRouter sends read-only statements to named replica groups based on
+// query hints and configured rules. Writes, transactions and pinned sessions
+// are left to the next router.
+type RuleRouter struct {
+	rules []Rule
+	base  *Router
+}
+
+func NewRuleRouter(rules []Rule) (*RuleRouter, error) {
+	rr := &RuleRouter{base: NewRouter()}
+	for _, r := range rules {
+		if r.Group == "" {
+			return nil, fmt.Errorf("routing rule without group")
+		}
+		if r.Query != "" {
+			re, err := regexp.Compile(r.Query)
+			if err != nil {
+				return nil, fmt.Errorf("routing rule for group %q: %w", r.Group, err)
+			}
+			r.pattern = re
+		}
+		rr.rules = append(rr.rules, r)
+	}
+	return rr, nil
+}
+
+func (rr *RuleRouter) Decide(stmt Statement, sc SessionContext) (Decision, bool) {
+	if sc.InTransaction || sc.Pinned || rr.base.Route(stmt.Query, false) != Replica {
+		return Decision{}, false
+	}
+	if g, ok := GroupHint(stmt.Query); ok {
+		return Decision{Destination: Replica, Group: g, Reason: "query hint"}, true
+	}
+	for i := range rr.rules {
+		if rr.rules[i].matches(stmt, sc) {
+			return Decision{Destination: Replica, Group: rr.rules[i].Group, Reason: fmt.Sprintf("rule %d", i)}, true
+		}
+	}
+	return Decision{}, false
+}
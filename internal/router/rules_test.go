@@ -0,0 +1,71 @@
+package router
+
+import (
+	"testing"
+)
+
+func TestGroupHint(t *testing.T) {
+	tests := []struct {
+		query string
+		group string
+		ok    bool
+	}{
+		{"/* pggate:group=analytics */ SELECT 1", "analytics", true},
+		{"SELECT 1 /* app=web pggate:group=eu-readers */", "eu-readers", true},
+		{"SELECT 'pggate:group=analytics'", "", false},
+		{"SELECT 1", "", false},
+	}
+
+	for _, tt := range tests {
+		group, ok := GroupHint(tt.query)
+		if group != tt.group || ok != tt.ok {
+			t.Errorf("GroupHint(%q) = %q, %v, want %q, %v", tt.query, group, ok, tt.group, tt.ok)
+		}
+	}
+}
+
+func TestRuleRouter_Decide(t *testing.T) {
+	rr, err := NewRuleRouter([]Rule{
+		{Group: "analytics", ApplicationName: "metabase"},
+		{Group: "reports", Query: `(?i)from\s+events`},
+	})
+	if err != nil {
+		t.Fatalf("NewRuleRouter() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		sc    SessionContext
+		group string
+		ok    bool
+	}{
+		{"application rule", "SELECT 1", SessionContext{ApplicationName: "metabase"}, "analytics", true},
+		{"query rule", "SELECT count(*) FROM events", SessionContext{}, "reports", true},
+		{"hint wins", "/* pggate:group=eu */ SELECT 1", SessionContext{ApplicationName: "metabase"}, "eu", true},
+		{"no match", "SELECT 1", SessionContext{}, "", false},
+		{"write ignored", "INSERT INTO events VALUES (1)", SessionContext{ApplicationName: "metabase"}, "", false},
+		{"transaction ignored", "SELECT 1", SessionContext{ApplicationName: "metabase", InTransaction: true}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := rr.Decide(ParseStatement(tt.query), tt.sc)
+			if ok != tt.ok || d.Group != tt.group {
+				t.Errorf("RuleRouter.Decide() = %q, %v, want %q, %v", d.Group, ok, tt.group, tt.ok)
+			}
+			if ok && d.Destination != Replica {
+				t.Errorf("RuleRouter.Decide() destination = %v, want %v", d.Destination, Replica)
+			}
+		})
+	}
+}
+
+func TestNewRuleRouter_Invalid(t *testing.T) {
+	if _, err := NewRuleRouter([]Rule{{Query: "SELECT"}}); err == nil {
+		t.Error("NewRuleRouter() expected error for rule without group, got nil")
+	}
+	if _, err := NewRuleRouter([]Rule{{Group: "g", Query: "("}}); err == nil {
+		t.Error("NewRuleRouter() expected error for invalid pattern, got nil")
+	}
+}
@@ -0,0 +1,107 @@
+// Package slowlog writes queries that exceed a latency threshold as JSON
+// lines.
+package slowlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/user/pggate/internal/stats"
+)
+
+type Config struct {
+	Threshold time.Duration
+	// Path is the file entries are appended to; empty or "stdout" writes to
+	// standard output, "stderr" to standard error.
+	Path string
+	// Redact replaces literals in the logged query text with placeholders.
+	Redact bool
+}
+
+// Entry is one slow query.
+type Entry struct {
+	Time            time.Time     `json:"time"`
+	Duration        time.Duration `json:"-"`
+	DurationMs      float64       `json:"duration_ms"`
+	Query           string        `json:"query"`
+	Fingerprint     string        `json:"fingerprint,omitempty"`
+	Destination     string        `json:"destination"`
+	Backend         string        `json:"backend"`
+	User            string        `json:"user"`
+	Database        string        `json:"database"`
+	ApplicationName string        `json:"application_name,omitempty"`
+	ClientAddr      string        `json:"client_addr"`
+	Rows            int64         `json:"rows"`
+}
+
+type Logger struct {
+	cfg    Config
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// New opens the slow query log. It returns a nil Logger, which discards
+// everything, when cfg.Threshold is not positive.
+func New(cfg Config) (*Logger, error) {
+	if cfg.Threshold <= 0 {
+		return nil, nil
+	}
+	l := &Logger{cfg: cfg}
+	switch cfg.Path {
+	case "", "stdout":
+		l.enc = json.NewEncoder(os.Stdout)
+	case "stderr":
+		l.enc = json.NewEncoder(os.Stderr)
+	default:
+		f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open slow query log: %w", err)
+		}
+		l.enc = json.NewEncoder(f)
+		l.closer = f
+	}
+	return l, nil
+}
+
+// NewWriter returns a Logger writing to w, mainly for tests.
+func NewWriter(cfg Config, w io.Writer) *Logger {
+	return &Logger{cfg: cfg, enc: json.NewEncoder(w)}
+}
+
+// Slow reports whether a query taking d is logged.
+func (l *Logger) Slow(d time.Duration) bool {
+	return l != nil && d >= l.cfg.Threshold
+}
+
+// Log writes e if it took at least the threshold.
+func (l *Logger) Log(e Entry) error {
+	if !l.Slow(e.Duration) {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.DurationMs = float64(e.Duration) / float64(time.Millisecond)
+	if l.cfg.Redact {
+		e.Query = stats.Normalize(e.Query)
+		e.Fingerprint = stats.Fingerprint(e.Query)
+	} else {
+		e.Fingerprint = stats.Fingerprint(stats.Normalize(e.Query))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(e)
+}
+
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
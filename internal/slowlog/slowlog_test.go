@@ -0,0 +1,77 @@
+package slowlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWriter(Config{Threshold: 100 * time.Millisecond, Redact: true}, &buf)
+
+	if err := l.Log(Entry{Duration: 10 * time.Millisecond, Query: "SELECT 1"}); err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Log() wrote a query under the threshold: %s", buf.String())
+	}
+
+	err := l.Log(Entry{
+		Duration:   250 * time.Millisecond,
+		Query:      "SELECT * FROM users WHERE email = 'a@example.com'",
+		Backend:    "replica1:5432",
+		User:       "app",
+		ClientAddr: "10.0.0.1:5000",
+		Rows:       1,
+	})
+	if err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Log() wrote invalid JSON %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"duration_ms": 250.0,
+		"query":       "SELECT * FROM users WHERE email = ?",
+		"backend":     "replica1:5432",
+		"user":        "app",
+		"client_addr": "10.0.0.1:5000",
+		"rows":        1.0,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("entry[%q] = %v, want %v", k, got[k], v)
+		}
+	}
+	if got["time"] == "" || got["fingerprint"] == "" {
+		t.Errorf("entry missing time or fingerprint: %v", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	l, err := New(Config{})
+	if err != nil || l != nil {
+		t.Errorf("New() without threshold = %v, %v, want nil, nil", l, err)
+	}
+	// a nil Logger discards
+	if l.Slow(time.Hour) || l.Log(Entry{Duration: time.Hour}) != nil || l.Close() != nil {
+		t.Errorf("nil Logger did not discard")
+	}
+
+	path := filepath.Join(t.TempDir(), "slow.log")
+	l, err = New(Config{Threshold: time.Millisecond, Path: path})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	l.Log(Entry{Duration: time.Second, Query: "SELECT 1"})
+	l.Close()
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Contains(data, []byte(`"query":"SELECT 1"`)) {
+		t.Errorf("log file = %q, %v", data, err)
+	}
+}
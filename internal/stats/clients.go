@@ -0,0 +1,148 @@
+// Package stats aggregates query statistics seen by the proxy.
+package stats
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/pggate/internal/metrics"
+)
+
+// DefaultMaxClients bounds the number of distinct client keys tracked.
+const DefaultMaxClients = 1000
+
+// Overflow is the label value clients beyond the limit are folded into.
+const Overflow = "__other__"
+
+// ClientKey identifies a client by its StartupMessage parameters.
+type ClientKey struct {
+	User            string `json:"user"`
+	Database        string `json:"database"`
+	ApplicationName string `json:"application_name"`
+}
+
+// ClientCounters are the running totals of one client key. They are updated
+// with atomics so sessions can keep a pointer to their entry.
+type ClientCounters struct {
+	sessions  atomic.Int64
+	queries   atomic.Int64
+	errors    atomic.Int64
+	bytesIn   atomic.Int64
+	bytesOut  atomic.Int64
+	timeNanos atomic.Int64
+}
+
+func (c *ClientCounters) SessionStarted() { c.sessions.Add(1) }
+func (c *ClientCounters) SessionEnded()   { c.sessions.Add(-1) }
+func (c *ClientCounters) Query()          { c.queries.Add(1) }
+func (c *ClientCounters) Error()          { c.errors.Add(1) }
+
+// Received counts bytes read from the client.
+func (c *ClientCounters) Received(n int) { c.bytesIn.Add(int64(n)) }
+
+// Sent counts bytes written to the client.
+func (c *ClientCounters) Sent(n int) { c.bytesOut.Add(int64(n)) }
+
+// Spent adds time spent executing queries.
+func (c *ClientCounters) Spent(d time.Duration) { c.timeNanos.Add(int64(d)) }
+
+// ClientStats is a snapshot of one client key.
+type ClientStats struct {
+	ClientKey
+	Sessions int64         `json:"sessions"`
+	Queries  int64         `json:"queries"`
+	Errors   int64         `json:"errors"`
+	BytesIn  int64         `json:"bytes_in"`
+	BytesOut int64         `json:"bytes_out"`
+	Time     time.Duration `json:"time_ns"`
+}
+
+// Clients tracks counters per client key. Once max keys are tracked, new
+// keys share a single overflow entry so label cardinality stays bounded.
+type Clients struct {
+	max      int
+	mu       sync.Mutex
+	entries  map[ClientKey]*ClientCounters
+	overflow ClientCounters
+}
+
+func NewClients(max int) *Clients {
+	if max <= 0 {
+		max = DefaultMaxClients
+	}
+	return &Clients{max: max, entries: make(map[ClientKey]*ClientCounters)}
+}
+
+// For returns the counters of key, creating them if there is room.
+func (c *Clients) For(key ClientKey) *ClientCounters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		return e
+	}
+	if len(c.entries) >= c.max {
+		return &c.overflow
+	}
+	e := &ClientCounters{}
+	c.entries[key] = e
+	return e
+}
+
+// Snapshot returns every tracked key sorted by user, database and
+// application name, followed by the overflow entry if it was used.
+func (c *Clients) Snapshot() []ClientStats {
+	c.mu.Lock()
+	out := make([]ClientStats, 0, len(c.entries)+1)
+	for k, e := range c.entries {
+		out = append(out, e.snapshot(k))
+	}
+	c.mu.Unlock()
+	slices.SortFunc(out, func(a, b ClientStats) int {
+		return strings.Compare(a.User+"\x00"+a.Database+"\x00"+a.ApplicationName,
+			b.User+"\x00"+b.Database+"\x00"+b.ApplicationName)
+	})
+	if o := c.overflow.snapshot(ClientKey{Overflow, Overflow, Overflow}); o.Queries > 0 || o.Sessions > 0 {
+		out = append(out, o)
+	}
+	return out
+}
+
+func (e *ClientCounters) snapshot(k ClientKey) ClientStats {
+	return ClientStats{
+		ClientKey: k,
+		Sessions:  e.sessions.Load(),
+		Queries:   e.queries.Load(),
+		Errors:    e.errors.Load(),
+		BytesIn:   e.bytesIn.Load(),
+		BytesOut:  e.bytesOut.Load(),
+		Time:      time.Duration(e.timeNanos.Load()),
+	}
+}
+
+// Collect implements metrics.Collector.
+func (c *Clients) Collect() []metrics.Family {
+	sessions := metrics.Family{Name: "pggate_client_sessions", Help: "Open client sessions per user, database and application", Type: metrics.GaugeType}
+	queries := metrics.Family{Name: "pggate_client_queries_total", Help: "Queries per user, database and application", Type: metrics.CounterType}
+	errors := metrics.Family{Name: "pggate_client_errors_total", Help: "Errors returned per user, database and application", Type: metrics.CounterType}
+	bytesIn := metrics.Family{Name: "pggate_client_received_bytes_total", Help: "Bytes received from clients per user, database and application", Type: metrics.CounterType}
+	bytesOut := metrics.Family{Name: "pggate_client_sent_bytes_total", Help: "Bytes sent to clients per user, database and application", Type: metrics.CounterType}
+	seconds := metrics.Family{Name: "pggate_client_query_seconds_total", Help: "Time spent executing queries per user, database and application", Type: metrics.CounterType}
+
+	for _, s := range c.Snapshot() {
+		labels := []metrics.Label{
+			{Name: "user", Value: s.User},
+			{Name: "database", Value: s.Database},
+			{Name: "application_name", Value: s.ApplicationName},
+		}
+		sessions.Series = append(sessions.Series, metrics.Series{Labels: labels, Value: float64(s.Sessions)})
+		queries.Series = append(queries.Series, metrics.Series{Labels: labels, Value: float64(s.Queries)})
+		errors.Series = append(errors.Series, metrics.Series{Labels: labels, Value: float64(s.Errors)})
+		bytesIn.Series = append(bytesIn.Series, metrics.Series{Labels: labels, Value: float64(s.BytesIn)})
+		bytesOut.Series = append(bytesOut.Series, metrics.Series{Labels: labels, Value: float64(s.BytesOut)})
+		seconds.Series = append(seconds.Series, metrics.Series{Labels: labels, Value: s.Time.Seconds()})
+	}
+	return []metrics.Family{sessions, queries, errors, bytesIn, bytesOut, seconds}
+}
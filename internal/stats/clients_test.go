@@ -0,0 +1,49 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClients(t *testing.T) {
+	c := NewClients(2)
+	app := c.For(ClientKey{User: "app", Database: "shop", ApplicationName: "web"})
+	if c.For(ClientKey{User: "app", Database: "shop", ApplicationName: "web"}) != app {
+		t.Errorf("For() returned different counters for the same key")
+	}
+	app.SessionStarted()
+	app.Query()
+	app.Query()
+	app.Error()
+	app.Received(10)
+	app.Sent(20)
+	app.Spent(time.Second)
+
+	c.For(ClientKey{User: "admin", Database: "shop"}).Query()
+	// over the limit: both fold into the overflow entry
+	c.For(ClientKey{User: "batch"}).Query()
+	c.For(ClientKey{User: "report"}).Query()
+
+	got := c.Snapshot()
+	if len(got) != 3 {
+		t.Fatalf("len(Snapshot()) = %d, want 3", len(got))
+	}
+	if got[0].User != "admin" || got[1].User != "app" || got[2].User != Overflow {
+		t.Errorf("Snapshot() users = %q, %q, %q, want admin, app, %s", got[0].User, got[1].User, got[2].User, Overflow)
+	}
+	want := ClientStats{
+		ClientKey: ClientKey{User: "app", Database: "shop", ApplicationName: "web"},
+		Sessions:  1, Queries: 2, Errors: 1, BytesIn: 10, BytesOut: 20, Time: time.Second,
+	}
+	if got[1] != want {
+		t.Errorf("Snapshot()[1] = %+v, want %+v", got[1], want)
+	}
+	if got[2].Queries != 2 {
+		t.Errorf("overflow queries = %d, want 2", got[2].Queries)
+	}
+
+	fs := c.Collect()
+	if len(fs) != 6 || len(fs[1].Series) != 3 || fs[1].Series[1].Value != 2 {
+		t.Errorf("Collect() = %+v", fs)
+	}
+}
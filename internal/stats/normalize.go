@@ -0,0 +1,177 @@
+package stats
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// Normalize replaces literals in query with ? placeholders, drops comments,
+// collapses whitespace and reduces IN lists to IN (...), so that queries
+// differing only in their parameters normalize to the same text.
+func Normalize(query string) string {
+	var b strings.Builder
+	space := false
+	emit := func(s string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			space = true
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i - 4
+			}
+			space = true
+			i += end + 4
+		case c == '\'':
+			emit("?")
+			i = skipString(query, i, false)
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				end = len(query) - i - 2
+			}
+			emit(query[i : i+end+2])
+			i += end + 2
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			// positional parameter
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			emit(query[i:j])
+			i = j
+		case c == '$':
+			if j, ok := skipDollarQuoted(query, i); ok {
+				emit("?")
+				i = j
+			} else {
+				emit("$")
+				i++
+			}
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			emit("?")
+			i = skipNumber(query, i)
+		case isIdent(c):
+			j := i
+			for j < len(query) && (isIdent(query[j]) || isDigit(query[j]) || query[j] == '$') {
+				j++
+			}
+			word := query[i:j]
+			if j < len(query) && query[j] == '\'' && isStringPrefix(word) {
+				// E'...', B'...', X'...', N'...'
+				emit("?")
+				i = skipString(query, j, strings.EqualFold(word, "e"))
+				continue
+			}
+			emit(word)
+			i = j
+		default:
+			emit(string(c))
+			i++
+		}
+	}
+	return inList.ReplaceAllString(b.String(), "IN (...)")
+}
+
+// inList matches an IN list of placeholders or positional parameters.
+var inList = regexp.MustCompile(`(?i)\bIN ?\( ?(?:\?|\$\d+)(?: ?, ?(?:\?|\$\d+))* ?\)`)
+
+// Fingerprint returns a short stable identifier of a normalized query.
+func Fingerprint(normalized string) string {
+	h := fnv.New64a()
+	h.Write([]byte(normalized))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// skipString returns the index after the quoted string starting at i,
+// honouring doubled quotes and, in E'...' strings, backslash escapes.
+func skipString(s string, i int, backslash bool) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if backslash {
+				j++
+			}
+		case '\'':
+			if j+1 < len(s) && s[j+1] == '\'' {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// skipDollarQuoted returns the index after the $tag$...$tag$ string starting
+// at i, or false if there is no valid opening tag.
+func skipDollarQuoted(s string, i int) (int, bool) {
+	j := i + 1
+	for j < len(s) && (isIdent(s[j]) || isDigit(s[j])) {
+		j++
+	}
+	if j >= len(s) || s[j] != '$' {
+		return 0, false
+	}
+	tag := s[i : j+1]
+	end := strings.Index(s[j+1:], tag)
+	if end < 0 {
+		return len(s), true
+	}
+	return j + 1 + end + len(tag), true
+}
+
+func skipNumber(s string, i int) int {
+	j := i
+	for j < len(s) && (isDigit(s[j]) || s[j] == '.') {
+		j++
+	}
+	if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+		k := j + 1
+		if k < len(s) && (s[k] == '+' || s[k] == '-') {
+			k++
+		}
+		if k < len(s) && isDigit(s[k]) {
+			for k < len(s) && isDigit(s[k]) {
+				k++
+			}
+			j = k
+		}
+	}
+	return j
+}
+
+func isStringPrefix(word string) bool {
+	switch strings.ToLower(word) {
+	case "e", "b", "x", "n":
+		return true
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,44 @@
+package stats
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM users WHERE id = 42", "SELECT * FROM users WHERE id = ?"},
+		{"select  *\n\tfrom t where name = 'O''Brien'", "select * from t where name = ?"},
+		{"SELECT 1.5e3, -2, .5", "SELECT ?, -?, ?"},
+		{"SELECT * FROM t WHERE id IN (1, 2, 3)", "SELECT * FROM t WHERE id IN (...)"},
+		{"SELECT * FROM t WHERE id in ($1,$2)", "SELECT * FROM t WHERE id IN (...)"},
+		{"SELECT * FROM t WHERE id IN (SELECT id FROM u)", "SELECT * FROM t WHERE id IN (SELECT id FROM u)"},
+		{"SELECT * FROM t WHERE id = $1", "SELECT * FROM t WHERE id = $1"},
+		{"SELECT col1, t2.c FROM t2", "SELECT col1, t2.c FROM t2"},
+		{`SELECT "Col 1" FROM "T"`, `SELECT "Col 1" FROM "T"`},
+		{"SELECT E'a\\'b', X'ff', 'C:\\'", "SELECT ?, ?, ?"},
+		{"SELECT $$it's$$, $fn$body$fn$", "SELECT ?, ?"},
+		{"/* pggate:group=analytics */ SELECT 1 -- trailing", "SELECT ?"},
+		{"INSERT INTO t VALUES (1, 'a')", "INSERT INTO t VALUES (?, ?)"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.query); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint(Normalize("SELECT * FROM t WHERE id = 1"))
+	b := Fingerprint(Normalize("SELECT *  FROM t WHERE id = 2"))
+	c := Fingerprint(Normalize("SELECT * FROM u WHERE id = 1"))
+	if a != b {
+		t.Errorf("Fingerprint() differs for queries differing only in literals: %s != %s", a, b)
+	}
+	if a == c {
+		t.Errorf("Fingerprint() equal for different tables: %s", a)
+	}
+	if len(a) != 16 {
+		t.Errorf("len(Fingerprint()) = %d, want 16", len(a))
+	}
+}
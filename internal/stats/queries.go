@@ -0,0 +1,137 @@
+package stats
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/user/pggate/internal/metrics"
+)
+
+// DefaultMaxQueries bounds the number of fingerprints tracked.
+const DefaultMaxQueries = 500
+
+// scoreHalfLife is how long it takes for the calls of a fingerprint to
+// count half as much when choosing which one to evict.
+const scoreHalfLife = 10 * time.Minute
+
+// QueryStats is a snapshot of one normalized query, in the spirit of
+// pg_stat_statements but across every backend.
+type QueryStats struct {
+	Fingerprint string        `json:"fingerprint"`
+	Query       string        `json:"query"` // normalized text
+	Calls       int64         `json:"calls"`
+	Rows        int64         `json:"rows"`
+	TotalTime   time.Duration `json:"total_time_ns"`
+	MeanTime    time.Duration `json:"mean_time_ns"`
+	P99Time     time.Duration `json:"p99_time_ns"`
+	Destination string        `json:"destination"` // of the last call
+	Backend     string        `json:"backend"`     // of the last call
+}
+
+type queryEntry struct {
+	query       string
+	calls       int64
+	rows        int64
+	total       time.Duration
+	destination string
+	backend     string
+	lastCall    time.Time
+	score       float64 // calls decayed by scoreHalfLife, as of lastCall
+	latency     *metrics.Histogram
+}
+
+// scoreAt returns the decayed call count of the entry at now.
+func (e *queryEntry) scoreAt(now time.Time) float64 {
+	return e.score * math.Exp2(-float64(now.Sub(e.lastCall))/float64(scoreHalfLife))
+}
+
+// Queries keeps the most frequent fingerprints. When full, the fingerprint
+// with the lowest call count, decayed with a half-life of scoreHalfLife, is
+// evicted to make room for a new one, so queries that stopped being called
+// give way to new ones.
+type Queries struct {
+	max     int
+	mu      sync.Mutex
+	entries map[string]*queryEntry
+}
+
+func NewQueries(max int) *Queries {
+	if max <= 0 {
+		max = DefaultMaxQueries
+	}
+	return &Queries{max: max, entries: make(map[string]*queryEntry)}
+}
+
+// Record accounts one execution of query.
+func (q *Queries) Record(query, destination, backend string, d time.Duration, rows int64) {
+	q.record(query, destination, backend, d, rows, time.Now())
+}
+
+func (q *Queries) record(query, destination, backend string, d time.Duration, rows int64, now time.Time) {
+	normalized := Normalize(query)
+	if normalized == "" {
+		return
+	}
+	fp := Fingerprint(normalized)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entries[fp]
+	if !ok {
+		if len(q.entries) >= q.max {
+			q.evictLocked(now)
+		}
+		e = &queryEntry{query: normalized, latency: metrics.NewHistogram(metrics.DefaultLatencyBuckets)}
+		q.entries[fp] = e
+	}
+	e.calls++
+	e.score = e.scoreAt(now) + 1
+	e.rows += rows
+	e.total += d
+	e.destination = destination
+	e.backend = backend
+	e.lastCall = now
+	e.latency.ObserveDuration(d)
+}
+
+// evictLocked drops the fingerprint with the lowest decayed call count at
+// now, the least recently used among ties. Called with q.mu held.
+func (q *Queries) evictLocked(now time.Time) {
+	var victim string
+	var ve *queryEntry
+	var vs float64
+	for fp, e := range q.entries {
+		s := e.scoreAt(now)
+		if ve == nil || s < vs || s == vs && e.lastCall.Before(ve.lastCall) {
+			victim, ve, vs = fp, e, s
+		}
+	}
+	delete(q.entries, victim)
+}
+
+// Snapshot returns every tracked fingerprint, by descending total time.
+func (q *Queries) Snapshot() []QueryStats {
+	q.mu.Lock()
+	out := make([]QueryStats, 0, len(q.entries))
+	for fp, e := range q.entries {
+		out = append(out, QueryStats{
+			Fingerprint: fp,
+			Query:       e.query,
+			Calls:       e.calls,
+			Rows:        e.rows,
+			TotalTime:   e.total,
+			MeanTime:    e.total / time.Duration(e.calls),
+			P99Time:     time.Duration(e.latency.Snapshot().Quantile(0.99) * float64(time.Second)),
+			Destination: e.destination,
+			Backend:     e.backend,
+		})
+	}
+	q.mu.Unlock()
+	slices.SortFunc(out, func(a, b QueryStats) int {
+		return cmp.Or(cmp.Compare(b.TotalTime, a.TotalTime), cmp.Compare(b.Calls, a.Calls), cmp.Compare(a.Fingerprint, b.Fingerprint))
+	})
+	return out
+}
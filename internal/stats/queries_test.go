@@ -0,0 +1,65 @@
+package stats
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueries(t *testing.T) {
+	q := NewQueries(2)
+	q.Record("SELECT * FROM t WHERE id = 1", "replica", "r1:5432", 10*time.Millisecond, 1)
+	q.Record("SELECT * FROM t WHERE id = 2", "replica", "r2:5432", 30*time.Millisecond, 1)
+	q.Record("UPDATE t SET v = 1", "primary", "p:5432", time.Millisecond, 5)
+	q.Record("   ", "primary", "p:5432", time.Millisecond, 0) // ignored
+
+	got := q.Snapshot()
+	if len(got) != 2 {
+		t.Fatalf("len(Snapshot()) = %d, want 2", len(got))
+	}
+	sel := got[0]
+	if sel.Query != "SELECT * FROM t WHERE id = ?" || sel.Calls != 2 || sel.Rows != 2 {
+		t.Errorf("Snapshot()[0] = %+v, want the SELECT with 2 calls and 2 rows", sel)
+	}
+	if sel.TotalTime != 40*time.Millisecond || sel.MeanTime != 20*time.Millisecond {
+		t.Errorf("total/mean = %v/%v, want 40ms/20ms", sel.TotalTime, sel.MeanTime)
+	}
+	if sel.P99Time < 25*time.Millisecond || sel.P99Time > 50*time.Millisecond {
+		t.Errorf("P99Time = %v, want within the 25ms-50ms bucket", sel.P99Time)
+	}
+	if sel.Destination != "replica" || sel.Backend != "r2:5432" {
+		t.Errorf("destination/backend = %s/%s, want replica/r2:5432", sel.Destination, sel.Backend)
+	}
+
+	// full: the least called fingerprint (the UPDATE) makes room
+	q.Record("DELETE FROM t", "primary", "p:5432", time.Millisecond, 0)
+	for _, s := range q.Snapshot() {
+		if s.Query == "UPDATE t SET v = ?" {
+			t.Errorf("Snapshot() still contains the evicted UPDATE")
+		}
+	}
+}
+
+func TestQueries_EvictsStale(t *testing.T) {
+	q := NewQueries(2)
+	start := time.Now()
+	for range 100 {
+		q.record("SELECT * FROM old", "replica", "r1:5432", time.Millisecond, 1, start)
+	}
+	q.record("SELECT * FROM other", "replica", "r1:5432", time.Millisecond, 1, start)
+
+	// an hour later the old query is no longer called and a new one is hot
+	later := start.Add(time.Hour)
+	for i := range 10 {
+		q.record("SELECT * FROM hot", "replica", "r1:5432", time.Millisecond, 1, later.Add(time.Duration(i)*time.Second))
+	}
+	q.record("SELECT * FROM new", "replica", "r1:5432", time.Millisecond, 1, later.Add(time.Minute))
+
+	var got []string
+	for _, s := range q.Snapshot() {
+		got = append(got, s.Query)
+	}
+	if !slices.Contains(got, "SELECT * FROM hot") || slices.Contains(got, "SELECT * FROM old") {
+		t.Errorf("Snapshot() = %q, want the hot query kept and the stale one evicted", got)
+	}
+}
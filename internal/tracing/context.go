@@ -0,0 +1,111 @@
+// Package tracing records spans of client sessions and queries and exports
+// them to an OpenTelemetry collector over OTLP/HTTP.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(v string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", v)
+	}
+	if parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("unsupported traceparent version in %q", v)
+	}
+	var sc SpanContext
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, fmt.Errorf("malformed trace id in %q", v)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, fmt.Errorf("malformed span id in %q", v)
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, fmt.Errorf("malformed trace flags in %q", v)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("all-zero id in traceparent %q", v)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// FromQuery extracts the trace context of a sqlcommenter comment such as
+// /*traceparent='00-...-...-01'*/ anywhere in query.
+func FromQuery(query string) (SpanContext, bool) {
+	for {
+		start := strings.Index(query, "/*")
+		if start < 0 {
+			return SpanContext{}, false
+		}
+		end := strings.Index(query[start+2:], "*/")
+		if end < 0 {
+			return SpanContext{}, false
+		}
+		comment := query[start+2 : start+2+end]
+		query = query[start+2+end+2:]
+
+		for _, kv := range strings.Split(comment, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok || strings.TrimSpace(k) != "traceparent" {
+				continue
+			}
+			v = strings.Trim(strings.TrimSpace(v), "'")
+			if u, err := url.QueryUnescape(v); err == nil {
+				v = u
+			}
+			if sc, err := ParseTraceparent(v); err == nil {
+				return sc, true
+			}
+		}
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
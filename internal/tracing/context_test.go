@@ -0,0 +1,66 @@
+package tracing
+
+import "testing"
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		in      string
+		sampled bool
+		wantErr bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", false, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, true},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, true},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false, true},
+		{"00-4bf92f35-00f067aa0ba902b7-01", false, true},
+	}
+	for _, tt := range tests {
+		sc, err := ParseTraceparent(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTraceparent(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && sc.Sampled != tt.sampled {
+			t.Errorf("ParseTraceparent(%q).Sampled = %v, want %v", tt.in, sc.Sampled, tt.sampled)
+		}
+	}
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if got := sc.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Traceparent() = %q", got)
+	}
+}
+
+func TestFromQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		ok    bool
+	}{
+		{
+			"SELECT 1 /*traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true,
+		},
+		{
+			"/* pggate:group=analytics */ SELECT * FROM t /*action='list',traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00'*/",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true,
+		},
+		{
+			// sqlcommenter URL-encodes values
+			"SELECT 1 /*traceparent='00%2D4bf92f3577b34da6a3ce929d0e0e4736%2D00f067aa0ba902b7%2D01'*/",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true,
+		},
+		{"SELECT 1 /*traceparent='garbage'*/", "", false},
+		{"SELECT 1", "", false},
+		{"SELECT 1 /* unterminated traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'", "", false},
+	}
+	for _, tt := range tests {
+		sc, ok := FromQuery(tt.query)
+		if ok != tt.ok || ok && sc.Traceparent() != tt.want {
+			t.Errorf("FromQuery(%q) = %s, %v, want %s, %v", tt.query, sc.Traceparent(), ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// OTLPExporter posts spans to a collector using the OTLP/HTTP JSON encoding.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+}
+
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// The types below mirror the JSON mapping of the OTLP
+// ExportTraceServiceRequest protobuf.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 is STATUS_CODE_ERROR
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 as a JSON string
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	out := make([]otlpSpan, len(spans))
+	for i, d := range spans {
+		s := otlpSpan{
+			TraceID:           d.Context.TraceID.String(),
+			SpanID:            d.Context.SpanID.String(),
+			Name:              d.Name,
+			Kind:              d.Kind,
+			StartTimeUnixNano: strconv.FormatInt(d.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(d.End.UnixNano(), 10),
+		}
+		if d.Parent.IsValid() {
+			s.ParentSpanID = d.Parent.String()
+		}
+		for _, a := range d.Attributes {
+			s.Attributes = append(s.Attributes, keyValue(a.Key, a.Value))
+		}
+		if d.Error != "" {
+			s.Status = &otlpStatus{Code: 2, Message: d.Error}
+		}
+		out[i] = s
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{keyValue("service.name", e.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "pggate"}, Spans: out}},
+	}}}
+}
+
+func keyValue(key string, value any) otlpKeyValue {
+	var v otlpValue
+	switch x := value.(type) {
+	case bool:
+		v.BoolValue = &x
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &x
+	case string:
+		v.StringValue = &x
+	default:
+		s := fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
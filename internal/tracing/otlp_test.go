@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is an OTLP/HTTP stub recording the spans it receives.
+type collector struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+	svc   string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var req otlpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		c.svc = *rs.Resource.Attributes[0].Value.StringValue
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	w.Write([]byte("{}"))
+}
+
+func TestTracer_OTLP(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	tr := New(Config{Endpoint: srv.URL + "/v1/traces", SampleRatio: 1, FlushInterval: time.Hour})
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	q := tr.Start(parent, "pggate.query", KindServer)
+	q.SetAttr("db.rows", 3)
+	q.SetAttr("db.user", "app")
+	exec := q.Child("pggate.execute", KindClient)
+	exec.SetError(errors.New("backend error"))
+	exec.End()
+	q.End()
+	q.End() // ending twice exports once
+
+	// not sampled by the client: nothing is exported
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	tr.Start(unsampled, "pggate.query", KindServer).End()
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.svc != DefaultServiceName {
+		t.Errorf("service.name = %q, want %q", c.svc, DefaultServiceName)
+	}
+	if len(c.spans) != 2 {
+		t.Fatalf("collector received %d spans, want 2", len(c.spans))
+	}
+	e, s := c.spans[0], c.spans[1]
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID != "00f067aa0ba902b7" || s.Kind != KindServer {
+		t.Errorf("query span = %+v, want child of the client span", s)
+	}
+	if e.TraceID != s.TraceID || e.ParentSpanID != s.SpanID {
+		t.Errorf("execute span parent = %s/%s, want %s/%s", e.TraceID, e.ParentSpanID, s.TraceID, s.SpanID)
+	}
+	if e.Status == nil || e.Status.Code != 2 || e.Status.Message != "backend error" {
+		t.Errorf("execute span status = %+v, want error", e.Status)
+	}
+	if len(s.Attributes) != 2 || *s.Attributes[0].Value.IntValue != "3" || *s.Attributes[1].Value.StringValue != "app" {
+		t.Errorf("query span attributes = %+v", s.Attributes)
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	tr := New(Config{})
+	if tr != nil {
+		t.Fatalf("New() without endpoint = %v, want nil", tr)
+	}
+	s := tr.Start(SpanContext{}, "x", KindInternal)
+	s.SetAttr("k", "v")
+	s.Child("y", KindInternal).End()
+	s.End()
+	if s.Context().IsValid() {
+		t.Errorf("nil span has a valid context")
+	}
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+func TestTracer_SampleRatioZero(t *testing.T) {
+	tr := NewWithExporter(Config{SampleRatio: 0}, nil)
+	defer tr.Shutdown(context.Background())
+
+	if tr.Start(SpanContext{}, "new", KindServer).Context().Sampled {
+		t.Error("new trace sampled with SampleRatio 0")
+	}
+	parent := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: true}
+	if !tr.Start(parent, "continued", KindServer).Context().Sampled {
+		t.Error("trace continued from a sampled client not sampled with SampleRatio 0")
+	}
+}
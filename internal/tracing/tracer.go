@@ -0,0 +1,276 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type SpanKind int
+
+// Span kinds as numbered by OTLP.
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces URL, e.g.
+	// http://localhost:4318/v1/traces.
+	Endpoint    string
+	ServiceName string
+	// SampleRatio is the fraction of new traces recorded, so 0 records only
+	// traces continued from a client, which follow the client's sampling
+	// decision.
+	SampleRatio   float64
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+}
+
+const (
+	DefaultServiceName   = "pggate"
+	DefaultBatchSize     = 256
+	DefaultFlushInterval = 5 * time.Second
+	DefaultQueueSize     = 4096
+)
+
+// Tracer creates spans and exports the sampled ones in batches. A nil
+// Tracer creates nil spans, on which every method is a no-op.
+type Tracer struct {
+	cfg      Config
+	exporter Exporter
+	queue    chan SpanData
+	dropped  atomic.Int64
+	done     chan struct{} // closed by Shutdown
+	stopped  chan struct{} // closed once the queue is exported
+	stopOnce sync.Once
+}
+
+// Exporter sends finished spans to a backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// New returns a tracer exporting to cfg.Endpoint over OTLP/HTTP, or nil when
+// no endpoint is configured.
+func New(cfg Config) *Tracer {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = DefaultServiceName
+	}
+	return NewWithExporter(cfg, NewOTLPExporter(cfg.Endpoint, cfg.ServiceName))
+}
+
+// NewWithExporter returns a tracer sending spans to e.
+func NewWithExporter(cfg Config, e Exporter) *Tracer {
+	cfg.SampleRatio = min(max(cfg.SampleRatio, 0), 1)
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	t := &Tracer{
+		cfg:      cfg,
+		exporter: e,
+		queue:    make(chan SpanData, cfg.QueueSize),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start begins a span. A valid parent makes it a child, otherwise it starts
+// a new trace.
+func (t *Tracer) Start(parent SpanContext, name string, kind SpanKind) *Span {
+	return t.StartAt(parent, name, kind, time.Now())
+}
+
+func (t *Tracer) StartAt(parent SpanContext, name string, kind SpanKind, start time.Time) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:  name,
+			Kind:  kind,
+			Start: start,
+		},
+	}
+	if parent.IsValid() {
+		s.data.Context = SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: parent.Sampled}
+		s.data.Parent = parent.SpanID
+	} else {
+		s.data.Context = SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: rand.Float64() < t.cfg.SampleRatio}
+	}
+	return s
+}
+
+// Dropped returns the number of spans discarded because the export queue
+// was full.
+func (t *Tracer) Dropped() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+func (t *Tracer) enqueue(d SpanData) {
+	select {
+	case t.queue <- d:
+	case <-t.done:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+	var batch []SpanData
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			slog.Warn("exporting spans failed", "spans", len(batch), "err", err)
+		}
+		cancel()
+		batch = nil
+	}
+	for {
+		select {
+		case d := <-t.queue:
+			batch = append(batch, d)
+			if len(batch) >= t.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case d := <-t.queue:
+					batch = append(batch, d)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown exports the queued spans and stops the tracer. Spans ended
+// afterwards are discarded.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.done) })
+	select {
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SpanData is a finished span.
+type SpanData struct {
+	Context    SpanContext
+	Parent     SpanID
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Error      string
+}
+
+type Attribute struct {
+	Key   string
+	Value any // string, bool, int64 or float64
+}
+
+// Span is an operation being timed. Its methods are safe to call on a nil
+// Span, and must not be called concurrently.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// Child starts a span under s.
+func (s *Span) Child(name string, kind SpanKind) *Span {
+	return s.ChildAt(name, kind, time.Now())
+}
+
+func (s *Span) ChildAt(name string, kind SpanKind, start time.Time) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.StartAt(s.data.Context, name, kind, start)
+}
+
+// SetAttr records an attribute. Values other than strings, bools, ints and
+// float64s are formatted as strings.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	switch v := value.(type) {
+	case string, bool, int64, float64:
+	case int:
+		value = int64(v)
+	default:
+		value = fmt.Sprint(v)
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: value})
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.data.Error = err.Error()
+}
+
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+func (s *Span) EndAt(end time.Time) {
+	if s == nil || s.ended {
+		return
+	}
+	s.ended = true
+	if !s.data.Context.Sampled {
+		return
+	}
+	s.data.End = end
+	s.tracer.enqueue(s.data)
+}